@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Drainer 让应用程序在不退出的情况下暂时摘除流量：就绪状态变为 false，
+// 服务器不再保持 keep-alive 连接，但正在处理的请求会正常完成。
+// 处理程序不能直接依赖 *http.Server（服务器依赖处理程序，会形成循环），所以由 NewHTTPServer 把服务器登记到 Drainer。
+type Drainer struct {
+	probe *ReadinessProbe
+
+	mu       sync.Mutex
+	servers  []*http.Server
+	draining bool
+}
+
+func NewDrainer(probe *ReadinessProbe) *Drainer {
+	return &Drainer{probe: probe}
+}
+
+func (d *Drainer) track(srv *http.Server) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = append(d.servers, srv)
+	srv.SetKeepAlivesEnabled(!d.draining)
+}
+
+// Drain 将就绪状态置为 false，并关闭空闲的 keep-alive 连接。
+func (d *Drainer) Drain() {
+	d.setDraining(true)
+}
+
+// Undrain 恢复 keep-alive 连接，并撤销 Drain 对就绪状态的影响，见 ReadinessProbe。
+func (d *Drainer) Undrain() {
+	d.setDraining(false)
+}
+
+func (d *Drainer) setDraining(draining bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draining = draining
+	for _, srv := range d.servers {
+		// 关闭 keep-alive 时，net/http 也会关闭当前空闲的连接。
+		srv.SetKeepAlivesEnabled(!draining)
+	}
+	d.probe.SetDraining(draining)
+}
+
+// DrainHandler 处理 POST /admin/drain。
+type DrainHandler struct {
+	log     *zap.Logger
+	drainer *Drainer
+}
+
+func NewDrainHandler(log *zap.Logger, drainer *Drainer) *DrainHandler {
+	return &DrainHandler{log: log, drainer: drainer}
+}
+
+func (*DrainHandler) Pattern() string {
+	return "/admin/drain"
+}
+
+func (*DrainHandler) Admin() bool {
+	return true
+}
+
+func (*DrainHandler) Methods() []string {
+	return []string{http.MethodPost}
+}
+
+func (h *DrainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.drainer.Drain()
+	h.log.Info("Draining traffic")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UndrainHandler 处理 POST /admin/undrain。
+type UndrainHandler struct {
+	log     *zap.Logger
+	drainer *Drainer
+}
+
+func NewUndrainHandler(log *zap.Logger, drainer *Drainer) *UndrainHandler {
+	return &UndrainHandler{log: log, drainer: drainer}
+}
+
+func (*UndrainHandler) Pattern() string {
+	return "/admin/undrain"
+}
+
+func (*UndrainHandler) Admin() bool {
+	return true
+}
+
+func (*UndrainHandler) Methods() []string {
+	return []string{http.MethodPost}
+}
+
+func (h *UndrainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.drainer.Undrain()
+	h.log.Info("Resuming traffic")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestDrainerReadiness(t *testing.T) {
+	tests := []struct {
+		name      string
+		ready     bool
+		steps     func(d *Drainer, p *ReadinessProbe)
+		wantReady bool
+	}{
+		{name: "drained", ready: true, steps: func(d *Drainer, p *ReadinessProbe) { d.Drain() }, wantReady: false},
+		{name: "undrained", ready: true, steps: func(d *Drainer, p *ReadinessProbe) { d.Drain(); d.Undrain() }, wantReady: true},
+		{name: "not started", ready: false, steps: func(d *Drainer, p *ReadinessProbe) { d.Drain(); d.Undrain() }, wantReady: false},
+		{name: "undrain during shutdown", ready: true, steps: func(d *Drainer, p *ReadinessProbe) {
+			d.Drain()
+			p.SetReady(false)
+			d.Undrain()
+		}, wantReady: false},
+		{name: "started while drained", ready: false, steps: func(d *Drainer, p *ReadinessProbe) {
+			d.Drain()
+			p.SetReady(true)
+		}, wantReady: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe := NewReadinessProbe()
+			probe.SetReady(tt.ready)
+			d := NewDrainer(probe)
+			tt.steps(d, probe)
+			if got := probe.Ready(); got != tt.wantReady {
+				t.Errorf("Ready() = %v, want %v", got, tt.wantReady)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// AdminRoute 是一个可选接口。Admin 返回 true 的路由只允许 AdminConfig.AllowedCIDRs 中的客户端访问。
+type AdminRoute interface {
+	Route
+	Admin() bool
+}
+
+// AdminMiddleware 限制运维接口的访问来源。NewRouter 只把它套在实现了 AdminRoute 的路由上。
+type AdminMiddleware Middleware
+
+func NewAdminMiddleware(cfg *Config, renderer *ErrorRenderer) (AdminMiddleware, error) {
+	mw, err := IPAllowlistMiddleware(cfg.Admin.AllowedCIDRs, renderer)
+	return AdminMiddleware(mw), err
+}
+
+// IPAllowlistMiddleware 对不在 cidrs 范围内的客户端返回 403。cidrs 为空时不做限制。
+// 客户端地址取自 RemoteAddr，无法解析为 IP 的地址（例如 Unix 套接字）会被拒绝。
+func IPAllowlistMiddleware(cidrs []string, renderer *ErrorRenderer) (Middleware, error) {
+	prefixes, err := parseCIDRs(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return func(next http.Handler) http.Handler {
+		if len(prefixes) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowed(prefixes, r) {
+				renderer.Render(w, r, http.StatusForbidden, "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func parseCIDRs(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+func allowed(prefixes []netip.Prefix, r *http.Request) bool {
+	addr, err := clientAddr(r)
+	if err != nil {
+		return false
+	}
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientAddrKey struct{}
+
+// clientAddr 返回 RemoteAddr 中的 IP 地址。结果用 Memoize 缓存在请求内，
+// HTTPS 重定向、限流和运维接口的白名单共用同一次解析。
+func clientAddr(r *http.Request) (netip.Addr, error) {
+	return Memoize(r.Context(), clientAddrKey{}, func() (netip.Addr, error) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		addr, err := netip.ParseAddr(host)
+		// 让 ::ffff:127.0.0.1 这样的地址也能匹配 IPv4 范围。
+		return addr.Unmap(), err
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAddr(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+		wantErr    bool
+	}{
+		{name: "ipv4", remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		{name: "ipv6", remoteAddr: "[2001:db8::1]:443", want: "2001:db8::1"},
+		{name: "ipv4-mapped ipv6", remoteAddr: "[::ffff:127.0.0.1]:80", want: "127.0.0.1"},
+		{name: "no port", remoteAddr: "192.0.2.1", want: "192.0.2.1"},
+		{name: "unix socket", remoteAddr: "@", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			addr, err := clientAddr(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clientAddr() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && addr.String() != tt.want {
+				t.Errorf("clientAddr() = %v, want %v", addr, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPAllowlistMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		cidrs      []string
+		remoteAddr string
+		want       int
+	}{
+		{name: "no restriction", cidrs: nil, remoteAddr: "203.0.113.9:1", want: http.StatusOK},
+		{name: "allowed", cidrs: []string{"127.0.0.0/8"}, remoteAddr: "127.0.0.1:1", want: http.StatusOK},
+		{name: "mapped address allowed", cidrs: []string{"127.0.0.0/8"}, remoteAddr: "[::ffff:127.0.0.1]:1", want: http.StatusOK},
+		{name: "denied", cidrs: []string{"127.0.0.0/8"}, remoteAddr: "203.0.113.9:1", want: http.StatusForbidden},
+		{name: "unparsable", cidrs: []string{"127.0.0.0/8"}, remoteAddr: "@", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := IPAllowlistMiddleware(tt.cidrs, testRenderer(t))
+			if err != nil {
+				t.Fatalf("IPAllowlistMiddleware() error = %v", err)
+			}
+			h := NewRequestCacheMiddleware()(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheableRoute 是一个可选接口。Cacheable 返回 true 的路由会经过 CacheMiddleware，
+// 适用于开销大、结果在 TTL 内不变的 GET 接口。
+type CacheableRoute interface {
+	Route
+	Cacheable() bool
+}
+
+// CacheMiddleware 在内存中缓存 GET 请求的 200 响应，键为方法、路径和查询参数。
+// 它与 "middlewares" 组里的中间件不同：NewRouter 只把它套在实现了 CacheableRoute 的路由上。
+type CacheMiddleware Middleware
+
+// NewCacheMiddleware 按 CacheConfig 构建 CacheMiddleware，TTL 为 0 时不缓存。
+func NewCacheMiddleware(cfg *Config) CacheMiddleware {
+	c := cfg.Cache
+	if c.TTL <= 0 || c.MaxEntries <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	cache := newLRUCache(c.MaxEntries)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery
+			// 请求带有 Cache-Control: no-cache 时不读缓存，但新的响应仍会更新缓存。
+			if !hasCacheDirective(r.Header, "no-cache") && !hasCacheDirective(r.Header, "no-store") {
+				if entry, ok := cache.get(key, time.Now()); ok {
+					entry.writeTo(w)
+					return
+				}
+			}
+
+			w.Header().Set("X-Cache", "MISS")
+			cw := &cachingWriter{ResponseWriter: w, limit: c.MaxBodyBytes}
+			next.ServeHTTP(cw, r)
+			if entry, ok := cw.entry(time.Now().Add(c.TTL)); ok {
+				cache.add(key, entry)
+			}
+		})
+	}
+}
+
+// hasCacheDirective 报告 Cache-Control 头中是否包含 directive。
+func hasCacheDirective(h http.Header, directive string) bool {
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if strings.EqualFold(name, directive) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type cacheEntry struct {
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+func (e *cacheEntry) writeTo(w http.ResponseWriter) {
+	h := w.Header()
+	for k, v := range e.header {
+		h[k] = v
+	}
+	h.Set("X-Cache", "HIT")
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.body)
+}
+
+// cachingWriter 把响应照常写给客户端，同时在 limit 以内保留一份副本。
+type cachingWriter struct {
+	http.ResponseWriter
+	limit     int64
+	status    int
+	header    http.Header
+	buf       bytes.Buffer
+	uncached  bool
+	committed bool
+}
+
+// commit 记下状态码和处理程序设置的响应头。外层的中间件可能与处理程序共用同一个 Header，
+// 并在写出响应头时修改它，例如 compressWriter 添加的 Content-Encoding 和 Vary，
+// 所以响应头要在交给外层之前复制，否则缓存里会是未压缩的响应体配上 Content-Encoding: gzip。
+func (w *cachingWriter) commit(status int) {
+	if !w.committed {
+		w.committed = true
+		w.status = status
+		w.header = w.Header().Clone()
+	}
+}
+
+func (w *cachingWriter) WriteHeader(status int) {
+	w.commit(status)
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cachingWriter) Write(b []byte) (int, error) {
+	w.commit(http.StatusOK)
+	if !w.uncached {
+		if int64(w.buf.Len()+len(b)) > w.limit {
+			w.uncached = true
+			w.buf = bytes.Buffer{}
+		} else {
+			w.buf.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// 流式响应不缓存。
+func (w *cachingWriter) Flush() {
+	w.uncached = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *cachingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// entry 在响应可以被缓存时返回对应的缓存项：状态码为 200、没有 Set-Cookie、
+// 没有禁止共享缓存的 Cache-Control，并且完整地保留在内存中。
+func (w *cachingWriter) entry(expires time.Time) (*cacheEntry, bool) {
+	h := w.header
+	if w.uncached || w.status != http.StatusOK || h.Get("Set-Cookie") != "" ||
+		hasCacheDirective(h, "no-store") || hasCacheDirective(h, "private") {
+		return nil, false
+	}
+	h.Del("X-Cache")
+	return &cacheEntry{header: h, body: bytes.Clone(w.buf.Bytes()), expires: expires}, true
+}
+
+// lruCache 是一个并发安全、容量固定的 LRU 缓存。
+type lruCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *cacheEntry
+}
+
+func newLRUCache(max int) *lruCache {
+	return &lruCache{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *lruCache) get(key string, now time.Time) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	item := el.Value.(*lruItem)
+	if now.After(item.entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return item.entry, true
+}
+
+func (c *lruCache) add(key string, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*lruItem).entry = entry
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruItem{key: key, entry: entry})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruItem).key)
+	}
+}
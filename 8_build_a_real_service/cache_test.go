@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counterRoute 是可以缓存的路由，每次处理请求时计数加一并写出当前的计数。
+type counterRoute struct {
+	calls atomic.Int32
+}
+
+func (*counterRoute) Pattern() string { return "GET /counter" }
+func (*counterRoute) Cacheable() bool { return true }
+
+func (r *counterRoute) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	n := r.calls.Add(1)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "count=%d", n)
+}
+
+// RequestTimeout 为 0 时路由不经过 http.TimeoutHandler，缓存和压缩中间件共用同一个 Header，
+// 缓存的响应头不能带上 compressWriter 添加的 Content-Encoding 和 Vary。
+func TestCacheMiddlewareStoresHandlerHeaders(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Server.RequestTimeout = 0
+	cfg.Cache = CacheConfig{TTL: time.Minute, MaxEntries: 16, MaxBodyBytes: 1 << 10}
+	cfg.Compression.Enabled = true
+	route := &counterRoute{}
+	p := testRouterParams(t, cfg, route)
+	p.Cache = NewCacheMiddleware(cfg)
+	mux, err := p.build("main", p.Routes)
+	if err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+	h := NewCompressionMiddleware(cfg).Wrap(mux)
+
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/counter", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		return rec
+	}
+
+	first := get("gzip")
+	tests := []struct {
+		name         string
+		encoding     string
+		wantEncoding string
+	}{
+		{name: "gzip", encoding: "gzip", wantEncoding: "gzip"},
+		{name: "identity", encoding: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.encoding)
+			if got := rec.Header().Get("X-Cache"); got != "HIT" {
+				t.Errorf("X-Cache = %q, want HIT", got)
+			}
+			if got, want := gunzip(t, rec), gunzip(t, first); got != want {
+				t.Errorf("body = %q, want %q", got, want)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			for _, name := range []string{"Content-Type", "Vary"} {
+				if got, want := rec.Header().Values(name), first.Header().Values(name); !slices.Equal(got, want) {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+	if n := route.calls.Load(); n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+}
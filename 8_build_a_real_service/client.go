@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// NewHTTPClient 提供应用程序共享的出站 HTTP 客户端。
+func NewHTTPClient(cfg *Config) *http.Client {
+	return &http.Client{Timeout: cfg.Client.Timeout}
+}
+
+// OutboundClient 包装共享的 *http.Client，让处理程序发出的出站请求不会比入站请求活得更久。
+type OutboundClient struct {
+	client *http.Client
+	margin time.Duration
+}
+
+func NewOutboundClient(client *http.Client, cfg *Config) *OutboundClient {
+	return &OutboundClient{client: client, margin: cfg.Client.DeadlineMargin}
+}
+
+// Do 发送出站请求 out。它的截止时间不晚于入站请求 in 的截止时间减去 DeadlineMargin（为处理程序留出写响应的时间），
+// 入站请求被取消时（例如客户端断开）它也会被取消。调用者必须关闭响应体，以释放派生的 context。
+// 返回的错误已经过 ClassifyClientError 分类。
+func (c *OutboundClient) Do(in, out *http.Request) (*http.Response, error) {
+	ctx, cancel := outboundContext(in.Context(), out.Context(), c.margin)
+	resp, err := c.client.Do(out.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, ClassifyClientError(err)
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// outboundContext 从 out 派生一个 context，继承 in 剩余的截止时间（减去 margin）和取消信号。
+func outboundContext(in, out context.Context, margin time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(out)
+	stop := context.AfterFunc(in, func() { cancel(context.Cause(in)) })
+
+	if deadline, ok := in.Deadline(); ok {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithDeadline(ctx, deadline.Add(-margin))
+		return ctx, func() {
+			stop()
+			cancelTimeout()
+			cancel(context.Canceled)
+		}
+	}
+	return ctx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
+
+// cancelOnClose 在响应体关闭时释放出站请求的 context。
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// 出站请求失败的分类，见 ClassifyClientError。
+var (
+	ErrUpstreamTimeout     = errors.New("upstream timed out")
+	ErrUpstreamRefused     = errors.New("upstream refused the connection")
+	ErrUpstreamDNS         = errors.New("upstream host could not be resolved")
+	ErrUpstreamUnavailable = errors.New("upstream request failed")
+)
+
+// ClassifyClientError 把 http.Client 返回的错误（通常是 *url.Error）归入上面的某个哨兵错误，
+// 返回的错误同时包装了哨兵错误和原始错误，可以用 errors.Is 判断。
+// 入站请求被取消（context.Canceled）不属于上游的问题，原样返回；err 为 nil 时返回 nil。
+func ClassifyClientError(err error) error {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return err
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("%w: %w", ErrUpstreamDNS, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrUpstreamTimeout, err)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Errorf("%w: %w", ErrUpstreamRefused, err)
+	default:
+		return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+}
+
+// UpstreamStatus 返回处理程序应当为出站请求的错误返回的状态码：超时为 504，其他上游错误为 502。
+func UpstreamStatus(err error) int {
+	if errors.Is(err, ErrUpstreamTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/fx"
+)
+
+// Codec 是一种序列化格式。Encode 和 Decode 都按结构体的 json 标签确定字段名，所以换一种格式，客户端看到的结构不变，
+// 响应中的字段名也就是请求中的字段名。
+type Codec interface {
+	ContentType() string
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// AsCodec 把 f 提供的 Codec 放进 "codecs" 组，Codecs 在协商格式时会考虑它。
+func AsCodec(f any) any {
+	return fx.Annotate(
+		f,
+		fx.As(new(Codec)),
+		fx.ResultTags(`group:"codecs"`),
+	)
+}
+
+// errUnsupportedMediaType 是请求体的 Content-Type 没有对应的 Codec 时 Codecs.Decode 返回的错误。
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// Codecs 按请求协商序列化格式：请求体按 Content-Type 解码，响应按 Accept 编码。JSON 总是可用的，
+// 也是默认的格式：没有 Content-Type 的请求体按 JSON 解码，Accept 没有更偏好其他格式时（包括没有 Accept 和 "*/*"）输出 JSON。
+// 处理程序用 Codecs.Decode 和 Codecs.Write 代替直接使用 encoding/json 和 WriteJSON。
+type Codecs struct {
+	codecs []Codec
+}
+
+func NewCodecs(codecs []Codec) *Codecs {
+	return &Codecs{codecs: append([]Codec{jsonCodec{}}, codecs...)}
+}
+
+// ForResponse 返回 Accept 最偏好的 Codec，权重相同时选择靠前的，也就是 JSON。
+func (c *Codecs) ForResponse(r *http.Request) Codec {
+	accept := r.Header.Get("Accept")
+	best, bestQ := c.codecs[0], 0.0
+	if accept == "" {
+		return best
+	}
+	for _, codec := range c.codecs {
+		if q := acceptQuality(accept, codec.ContentType()); q > bestQ {
+			best, bestQ = codec, q
+		}
+	}
+	return best
+}
+
+// ForRequest 返回与请求体的 Content-Type 对应的 Codec，没有对应的 Codec 时返回 false。
+func (c *Codecs) ForRequest(r *http.Request) (Codec, bool) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return c.codecs[0], true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	for _, codec := range c.codecs {
+		if codec.ContentType() == mediaType {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// Decode 用 ForRequest 选出的 Codec 把请求体解码到 v。Content-Type 不受支持时返回的错误满足 errors.Is(err, errUnsupportedMediaType)。
+func (c *Codecs) Decode(r *http.Request, v any) error {
+	codec, ok := c.ForRequest(r)
+	if !ok {
+		return fmt.Errorf("%w %q", errUnsupportedMediaType, r.Header.Get("Content-Type"))
+	}
+	return codec.Decode(r.Body, v)
+}
+
+// Write 用 ForResponse 选出的 Codec 以 status 写出 v。和 WriteJSON 一样，编码失败时什么都不写。
+func (c *Codecs) Write(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	codec := c.ForResponse(r)
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, v); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	addVary(w.Header(), "Accept")
+	w.WriteHeader(status)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// jsonCodec 是默认的 Codec，输出与 WriteJSON 相同。未知的字段是错误，拼错的字段名不会被悄悄忽略。
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(body, '\n'))
+	return err
+}
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// msgpackCodec 使用 MessagePack，供偏好二进制格式的客户端使用。编码和解码都使用 json 标签中的字段名和 omitempty。
+type msgpackCodec struct{}
+
+func NewMsgPackCodec() Codec {
+	return msgpackCodec{}
+}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Encode(w io.Writer, v any) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+func (msgpackCodec) Decode(r io.Reader, v any) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(true)
+	return dec.Decode(v)
+}
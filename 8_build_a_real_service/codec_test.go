@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// 每个 Codec 编码出的内容都能被它自己解码回同样的值，字段名在两个方向上都来自 json 标签。
+func TestCodecRoundTrip(t *testing.T) {
+	values := []struct {
+		name string
+		v    any
+		ptr  func() any
+	}{
+		{name: "rate limit settings", v: RateLimitSettings{Rate: 2.5, Burst: 10}, ptr: func() any { return new(RateLimitSettings) }},
+		{name: "server time", v: serverTime{Time: "2026-01-02T03:04:05Z", Timezone: "UTC"}, ptr: func() any { return new(serverTime) }},
+		{
+			name: "slow request",
+			v:    SlowRequest{Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Method: "GET", Path: "/x", Status: 200, Duration: time.Second, RequestID: "abc"},
+			ptr:  func() any { return new(SlowRequest) },
+		},
+	}
+	for _, codec := range NewCodecs([]Codec{NewMsgPackCodec()}).codecs {
+		for _, tt := range values {
+			t.Run(codec.ContentType()+"/"+tt.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := codec.Encode(&buf, tt.v); err != nil {
+					t.Fatalf("Encode() error = %v", err)
+				}
+				got := tt.ptr()
+				if err := codec.Decode(&buf, got); err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				// MessagePack 解码出的时间使用本地时区。
+				if s, ok := got.(*SlowRequest); ok {
+					s.Time = s.Time.UTC()
+				}
+				if got := reflect.ValueOf(got).Elem().Interface(); !reflect.DeepEqual(got, tt.v) {
+					t.Errorf("round trip = %+v, want %+v", got, tt.v)
+				}
+			})
+		}
+	}
+}
+
+// 编码使用 json 标签中的名字，解码只接受这些名字。
+func TestCodecFieldNames(t *testing.T) {
+	msgpackBody := func(m map[string]any) string {
+		b, err := msgpack.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	tests := []struct {
+		name    string
+		codec   Codec
+		body    string
+		wantErr bool
+	}{
+		{name: "json tag names", codec: jsonCodec{}, body: `{"rate": 1, "burst": 2}`},
+		{name: "json unknown field", codec: jsonCodec{}, body: `{"rate": 1, "bursts": 2}`, wantErr: true},
+		{name: "msgpack tag names", codec: msgpackCodec{}, body: msgpackBody(map[string]any{"rate": 1.0, "burst": 2})},
+		{name: "msgpack go field names", codec: msgpackCodec{}, body: msgpackBody(map[string]any{"Rate": 1.0, "Burst": 2}), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s RateLimitSettings
+			err := tt.codec.Decode(strings.NewReader(tt.body), &s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (s != RateLimitSettings{Rate: 1, Burst: 2}) {
+				t.Errorf("decoded %+v", s)
+			}
+		})
+	}
+
+	// MessagePack 编码出的键与 JSON 相同，omitempty 同样生效。
+	var buf bytes.Buffer
+	if err := (msgpackCodec{}).Encode(&buf, SlowRequest{Method: "GET"}); err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := msgpack.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["duration_ns"]; !ok {
+		t.Errorf("msgpack keys = %v, want duration_ns", m)
+	}
+	if _, ok := m["request_id"]; ok {
+		t.Errorf("msgpack keys = %v, want request_id omitted", m)
+	}
+}
+
+func TestCodecsNegotiation(t *testing.T) {
+	codecs := NewCodecs([]Codec{NewMsgPackCodec()})
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		wantResp    string
+		wantReq     string
+	}{
+		{name: "defaults", wantResp: "application/json", wantReq: "application/json"},
+		{name: "msgpack", accept: "application/msgpack", contentType: "application/msgpack", wantResp: "application/msgpack", wantReq: "application/msgpack"},
+		{name: "wildcard prefers json", accept: "*/*", wantResp: "application/json", wantReq: "application/json"},
+		{name: "weighted", accept: "application/json;q=0.5, application/msgpack", wantResp: "application/msgpack", wantReq: "application/json"},
+		{name: "content type parameters", contentType: "application/json; charset=utf-8", wantResp: "application/json", wantReq: "application/json"},
+		{name: "unsupported request", contentType: "text/xml", wantResp: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if got := codecs.ForResponse(req).ContentType(); got != tt.wantResp {
+				t.Errorf("ForResponse() = %q, want %q", got, tt.wantResp)
+			}
+			codec, ok := codecs.ForRequest(req)
+			switch {
+			case tt.wantReq == "" && ok:
+				t.Errorf("ForRequest() = %q, want none", codec.ContentType())
+			case tt.wantReq != "" && (!ok || codec.ContentType() != tt.wantReq):
+				t.Errorf("ForRequest() = %v, %v, want %q", codec, ok, tt.wantReq)
+			}
+		})
+	}
+}
+
+func TestCodecsWriteAndDecode(t *testing.T) {
+	codecs := NewCodecs([]Codec{NewMsgPackCodec()})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/msgpack")
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Vary", "Accept-Encoding")
+	if err := codecs.Write(rec, req, http.StatusOK, RateLimitSettings{Rate: 1, Burst: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/msgpack" {
+		t.Errorf("Content-Type = %q, want application/msgpack", got)
+	}
+	if got := rec.Header().Values("Vary"); !slices.Equal(got, []string{"Accept-Encoding", "Accept"}) {
+		t.Errorf("Vary = %q, want [Accept-Encoding Accept]", got)
+	}
+
+	// 用响应体构造请求，检查 Decode 按 Content-Type 选择 Codec。
+	body := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(rec.Body.Bytes()))
+	body.Header.Set("Content-Type", "application/msgpack")
+	var got RateLimitSettings
+	if err := codecs.Decode(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (RateLimitSettings{Rate: 1, Burst: 2}) {
+		t.Errorf("Decode() = %+v", got)
+	}
+
+	unsupported := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("<x/>"))
+	unsupported.Header.Set("Content-Type", "application/xml")
+	if err := codecs.Decode(unsupported, &got); !errors.Is(err, errUnsupportedMediaType) {
+		t.Errorf("Decode() error = %v, want errUnsupportedMediaType", err)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// NewCompressionMiddleware 对接受 gzip 的客户端压缩响应。压缩级别来自 CompressionConfig.Level，
+// gzip.Writer 通过 sync.Pool 复用，避免每个请求都分配压缩器的内部缓冲区。
+// Vary: Accept-Encoding 在写出响应头时才添加，见 compressWriter。
+func NewCompressionMiddleware(cfg *Config) Wrapper {
+	level := cfg.Compression.Level
+	pool := &sync.Pool{
+		New: func() any {
+			// Level 已经被 Config.Validate 校验过，这里不会出错。
+			gz, _ := gzip.NewWriterLevel(io.Discard, level)
+			return gz
+		},
+	}
+	return Named("compression", func(next http.Handler) http.Handler {
+		if !cfg.Compression.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			compress := r.Method != http.MethodHead && acceptsGzip(r.Header.Get("Accept-Encoding"))
+			cw := &compressWriter{ResponseWriter: w, pool: pool, compress: compress}
+			// 不用 defer：处理程序 panic 时不能写出推迟的响应头，RecoveryMiddleware 还要返回 500。
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	})
+}
+
+// NewDecompressionMiddleware 透明地解压 Content-Encoding: gzip 的请求体，处理程序读到的是解压后的内容。
+// 解压后的大小同样受 BodyLimitMiddleware 使用的上限约束，超出时读取请求体会得到 *http.MaxBytesError，
+// 防止很小的压缩包解压出巨大的内容。不支持的编码返回 415。它必须位于 BodyLimitMiddleware 之内。
+// 请求结束后，压缩前后的字节数计入路由统计；解压比（解压后/压缩后）超过 CompressionConfig.RatioWarning 时
+// 记录一条 warn 日志，用来发现 zip 炸弹之类的攻击。
+func NewDecompressionMiddleware(p bodyLimitParams, log *zap.Logger, metrics *RouteMetrics) Middleware {
+	limitFor, _ := p.limits()
+	labels := newRouteLookup(p.Router, p.Routes, p.VHostRoutes, func(route Route) (string, bool) {
+		return metricLabel(route), true
+	})
+	threshold := p.Config.Compression.RatioWarning
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+			case "gzip", "x-gzip":
+			default:
+				w.Header().Set("Accept-Encoding", "gzip")
+				p.Renderer.Render(w, r, http.StatusUnsupportedMediaType, "unsupported content encoding "+strconv.Quote(enc))
+				return
+			}
+
+			compressed := &countingReader{ReadCloser: r.Body}
+			gz, err := gzip.NewReader(compressed)
+			if err != nil {
+				p.Renderer.Render(w, r, http.StatusBadRequest, "invalid gzip request body")
+				return
+			}
+			defer gz.Close()
+			decompressed := &countingReader{ReadCloser: gz}
+			var body io.ReadCloser = decompressed
+			if limit := limitFor(r); limit > 0 {
+				body = http.MaxBytesReader(w, decompressed, limit)
+			}
+			pattern := p.Router.Match(r)
+			label, hasLabel := labels.lookup(r)
+			// 解压后的长度未知。
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			next.ServeHTTP(w, r)
+
+			if hasLabel {
+				metrics.ObserveDecompression(label, compressed.n, decompressed.n)
+			}
+			if compressed.n == 0 {
+				return
+			}
+			if ratio := float64(decompressed.n) / float64(compressed.n); threshold > 0 && ratio > threshold {
+				loggerFrom(r.Context(), log).Warn("Suspicious request decompression ratio",
+					zap.String("route", pattern),
+					zap.Int64("compressed_bytes", compressed.n),
+					zap.Int64("decompressed_bytes", decompressed.n),
+					zap.Float64("ratio", ratio),
+					zap.Float64("threshold", threshold),
+				)
+			}
+		})
+	}
+}
+
+// countingReader 统计读出的字节数。
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// acceptsGzip 报告 Accept-Encoding 是否接受 gzip（q=0 表示明确拒绝）。
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, "gzip") && coding != "*" {
+			continue
+		}
+		k, v, _ := strings.Cut(strings.TrimSpace(params), "=")
+		if strings.EqualFold(k, "q") {
+			if q, err := strconv.ParseFloat(v, 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter 在写出响应头时决定是否压缩，只有需要压缩时才从池中取出 gzip.Writer。
+// 需要压缩时，WriteHeader 只记下状态码，响应头推迟到第一次 Write 时才写出：压缩之后 net/http 无法再根据内容推断 Content-Type，
+// 所以要在那之前用未压缩的内容推断。先调用 WriteHeader 的处理程序（包括 http.TimeoutHandler，它总是先写状态码）由此也能得到 Content-Type。
+// Vary 同样在写出响应头时才添加：http.TimeoutHandler 写出响应时会用处理程序设置的 Vary 覆盖之前已经设置的 Vary。
+type compressWriter struct {
+	http.ResponseWriter
+	pool *sync.Pool
+	// compress 报告客户端是否接受 gzip。
+	compress    bool
+	gz          *gzip.Writer
+	status      int
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	// 1xx 是信息性响应，真正的响应头还在后面。
+	if w.wroteHeader || status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if !w.compress || !bodyAllowed(status) {
+		w.writeHeader(nil)
+	}
+}
+
+// writeHeader 写出推迟的响应头。b 是响应体的第一段，用来推断 Content-Type；压缩而又没有内容可以推断时，
+// 使用 application/octet-stream。
+func (w *compressWriter) writeHeader(b []byte) {
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	h := w.Header()
+	addVary(h, "Accept-Encoding")
+	// 已经编码过的响应，以及不允许有响应体的状态码，不需要压缩。
+	if w.compress && h.Get("Content-Encoding") == "" && bodyAllowed(w.status) {
+		if h.Get("Content-Type") == "" {
+			ct := "application/octet-stream"
+			if len(b) > 0 {
+				ct = http.DetectContentType(b)
+			}
+			h.Set("Content-Type", ct)
+		}
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.writeHeader(b)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.writeHeader(nil)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close 写出 gzip 的结尾，并把 gzip.Writer 放回池中。
+// 放回之前把它 Reset 到 io.Discard，避免池中的对象继续引用已经结束的响应。
+// 处理程序没有写出响应体时不压缩，直接写出响应头。
+func (w *compressWriter) close() {
+	if !w.wroteHeader {
+		w.compress = false
+		w.writeHeader(nil)
+	}
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	w.gz.Reset(io.Discard)
+	w.pool.Put(w.gz)
+	w.gz = nil
+}
+
+// addVary 在 Vary 中还没有 value 时添加它。
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if f := strings.TrimSpace(field); f == "*" || strings.EqualFold(f, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// gunzip 解压响应体，响应没有压缩时原样返回。
+func gunzip(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		return rec.Body.String()
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("read gzip body: %v", err)
+	}
+	return string(body)
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	html := "<!DOCTYPE html><html><body>hi</body></html>"
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		wantStatus     int
+		wantEncoding   string
+		wantType       string
+		wantBody       string
+	}{
+		{
+			name:           "write sniffs content type",
+			acceptEncoding: "gzip",
+			handler:        func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, html) },
+			wantStatus:     http.StatusOK,
+			wantEncoding:   "gzip",
+			wantType:       "text/html; charset=utf-8",
+			wantBody:       html,
+		},
+		{
+			name:           "write header first sniffs content type",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, html)
+			},
+			wantStatus:   http.StatusCreated,
+			wantEncoding: "gzip",
+			wantType:     "text/html; charset=utf-8",
+			wantBody:     html,
+		},
+		{
+			name:           "WriteJSON keeps content type",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				WriteJSON(w, http.StatusAccepted, map[string]int{"n": 1})
+			},
+			wantStatus:   http.StatusAccepted,
+			wantEncoding: "gzip",
+			wantType:     "application/json",
+			wantBody:     "{\"n\":1}\n",
+		},
+		{
+			name:           "error renderer",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				testRenderer(t).Render(w, r, http.StatusNotFound, "")
+			},
+			wantStatus:   http.StatusNotFound,
+			wantEncoding: "gzip",
+			wantType:     "application/json",
+			wantBody:     "{\"status\":404,\"error\":\"Not Found\",\"code\":\"not_found\"}\n",
+		},
+		{
+			name:           "flush before write uses default content type",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NewResponseController(w).Flush()
+				io.WriteString(w, "tick\n")
+			},
+			wantStatus:   http.StatusOK,
+			wantEncoding: "gzip",
+			wantType:     "application/octet-stream",
+			wantBody:     "tick\n",
+		},
+		{
+			name:           "empty body is not compressed",
+			acceptEncoding: "gzip",
+			handler:        func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusAccepted) },
+			wantStatus:     http.StatusAccepted,
+		},
+		{
+			name:           "no content",
+			acceptEncoding: "gzip",
+			handler:        func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			wantStatus:     http.StatusNoContent,
+		},
+		{
+			name:           "already encoded",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, "raw")
+			},
+			wantStatus:   http.StatusOK,
+			wantEncoding: "br",
+			wantBody:     "raw",
+		},
+		{
+			name:           "gzip refused",
+			acceptEncoding: "gzip;q=0",
+			handler:        func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "plain") },
+			wantStatus:     http.StatusOK,
+			wantBody:       "plain",
+		},
+		{
+			name:           "head",
+			method:         http.MethodHead,
+			acceptEncoding: "gzip",
+			handler:        func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+			wantStatus:     http.StatusOK,
+		},
+	}
+	mw := NewCompressionMiddleware(testConfig(t))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+			mw.Wrap(tt.handler).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if tt.wantType != "" && rec.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", rec.Header().Get("Content-Type"), tt.wantType)
+			}
+			if got := rec.Header().Values("Vary"); !slices.Contains(got, "Accept-Encoding") {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if got := gunzip(t, rec); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCompressionMiddlewareDisabled(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Compression.Enabled = false
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	NewCompressionMiddleware(cfg).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "plain")
+	})).ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "" {
+		t.Errorf("Vary = %q, want none", got)
+	}
+}
+
+// 处理程序 panic 时，推迟的响应头不能被写出，RecoveryMiddleware 还要返回 500。
+func TestCompressionMiddlewarePanic(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h := NewCompressionMiddleware(testConfig(t)).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("boom")
+	}))
+	func() {
+		defer func() { recover() }()
+		h.ServeHTTP(rec, req)
+	}()
+	if rec.Code != http.StatusOK || len(rec.Result().Header) != 0 || rec.Body.Len() != 0 {
+		t.Errorf("response was written before the panic: status %d, headers %v", rec.Code, rec.Result().Header)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: "gzip", want: true},
+		{header: "GZIP", want: true},
+		{header: "deflate, gzip;q=0.5", want: true},
+		{header: "gzip;q=0", want: false},
+		{header: "*", want: true},
+		{header: "br", want: false},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestAddVary(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		want     []string
+	}{
+		{name: "empty", want: []string{"Accept-Encoding"}},
+		{name: "other value", existing: []string{"Accept"}, want: []string{"Accept", "Accept-Encoding"}},
+		{name: "already present", existing: []string{"Accept, accept-encoding"}, want: []string{"Accept, accept-encoding"}},
+		{name: "star", existing: []string{"*"}, want: []string{"*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for _, v := range tt.existing {
+				h.Add("Vary", v)
+			}
+			addVary(h, "Accept-Encoding")
+			if got := h.Values("Vary"); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Vary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// gzipped 返回 s 压缩后的内容。
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressionMiddleware(t *testing.T) {
+	routes := []Route{NewEchoHandler(zap.NewNop(), testRenderer(t)), limitedRoute{pattern: "/small", limit: 8}}
+	mux := NewRouterProvider().NewRouter()
+	for _, route := range routes {
+		mux.Handle(route.Pattern(), route)
+	}
+	p := bodyLimitParams{
+		Config:   &Config{Server: ServerConfig{MaxRequestBody: 1024}},
+		Renderer: testRenderer(t),
+		Router:   mux,
+		Routes:   routes,
+	}
+	h := NewBodyLimitMiddleware(p)(NewDecompressionMiddleware(p, zap.NewNop(), NewRouteMetrics())(mux))
+
+	tests := []struct {
+		name       string
+		target     string
+		encoding   string
+		body       []byte
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "gzip echoed decompressed", target: "/echo", encoding: "gzip", body: gzipped(t, "你好，gzip"), wantStatus: http.StatusOK, wantBody: "你好，gzip"},
+		{name: "identity", target: "/echo", body: []byte("plain"), wantStatus: http.StatusOK, wantBody: "plain"},
+		// 压缩后只有几十个字节，解压后超出 /small 的上限。
+		{name: "inflates past limit", target: "/small", encoding: "gzip", body: gzipped(t, strings.Repeat("x", 1000)), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "invalid gzip", target: "/echo", encoding: "gzip", body: []byte("not gzip"), wantStatus: http.StatusBadRequest},
+		{name: "unsupported encoding", target: "/echo", encoding: "br", body: []byte("x"), wantStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %q", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
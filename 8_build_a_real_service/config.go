@@ -0,0 +1,611 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config 汇总了应用程序的全部配置，由 ConfigModule 提供给其他构造函数。
+// 凭据、密钥之类的敏感字段要加上 `redact:"true"` 标签，它们在 /debug/config 中会被替换为 "***"。
+type Config struct {
+	Server ServerConfig
+	Log    LogConfig
+	Errors ErrorsConfig
+	Client ClientConfig
+	Cache  CacheConfig
+	Admin  AdminConfig
+
+	Compression  CompressionConfig
+	SlowRequests SlowRequestsConfig
+	Debug        DebugConfig
+	Maintenance  MaintenanceConfig
+	CSRF         CSRFConfig
+	Random       RandomConfig
+	AccessLog    AccessLogConfig
+	Favicon      FaviconConfig
+	Worker       WorkerConfig
+	Language     LanguageConfig
+	Docs         DocsConfig
+	RequestID    RequestIDConfig
+	Health       HealthConfig
+
+	HTTPSRedirect HTTPSRedirectConfig
+	Upload        UploadConfig
+	RateLimit     RateLimitConfig
+	Warmup        WarmupConfig
+	Lifecycle     LifecycleConfig
+	VHost         VHostConfig
+	Latency       LatencyConfig
+	Envelope      EnvelopeConfig
+
+	HostValidation HostValidationConfig
+}
+
+// ServerConfig 是 HTTP 服务器的配置。
+type ServerConfig struct {
+	// Network 是 "tcp"（默认）或 "unix"。使用 "unix" 时 Addr 是套接字文件的路径。
+	Network string
+	Addr    string
+
+	// LifecycleLogLevel 是服务器启动和停止日志的级别，默认为 "info"。
+	LifecycleLogLevel string
+
+	// ListenAttempts 是监听失败时的最大尝试次数，默认为 1（不重试）。
+	// 滚动部署时旧实例可能还占着端口，可以调大它，每次重试前等待 ListenBackoff，之后每次加倍。
+	ListenAttempts int
+	ListenBackoff  time.Duration
+
+	// RequestTimeout 是每个请求的默认超时时间。路由可以通过实现 TimeoutRoute 来覆盖它。
+	RequestTimeout time.Duration
+
+	// WriteTimeout 是每个请求从读完请求头到写完响应的最长时间，超过后写入失败，连接被关闭，
+	// 用来防止读取很慢的客户端一直占用连接。它包含处理程序的执行时间，所以必须大于最长的路由超时时间。
+	// 流式响应（/stream、/debug/logs）通过 http.ResponseController 清除了自己的写入截止时间，不受它限制。0 表示不限制。
+	WriteTimeout time.Duration
+
+	// DrainTimeout 是关闭时等待正在处理的请求自行完成的时间。超过之后，这些请求的 context 被取消，
+	// 遵守 context 的处理程序可以提前结束，而不是等到连接被强制关闭。0 表示不取消。
+	DrainTimeout time.Duration
+
+	// TrailingSlash 决定如何处理多余的尾部斜杠："redirect" 返回重定向，"rewrite" 在内部改写路径，留空表示不处理。
+	TrailingSlash string
+
+	// KeepAlive 是接受的 TCP 连接上的 keep-alive 探测参数：空闲多久后开始探测（Idle）、
+	// 探测间隔（Interval）和判定对端失联前的探测次数（Count）。长时间的流式连接位于 NAT 之后时，
+	// 它能及时发现已经断开的对端。字段为负数时使用操作系统的默认值。
+	KeepAlive net.KeepAliveConfig
+
+	// ReusePort 打开 SO_REUSEPORT，让同一台主机上的多个进程监听同一个端口，由内核在它们之间分配连接。
+	ReusePort bool
+
+	// Backlog 是监听队列的长度，0 表示使用系统的默认值（somaxconn）。它不能超过 somaxconn。
+	Backlog int
+
+	// MaxConnections 限制同时打开的连接数，0 表示不限制。
+	// 超出的连接不会被拒绝，而是留在内核的 accept 队列中，直到有连接关闭。
+	MaxConnections int
+
+	// MaxQueryParams 和 MaxQueryLength 限制查询参数的个数和查询字符串的总长度，超出时返回 400。0 表示不限制。
+	MaxQueryParams int
+	MaxQueryLength int
+
+	// MaxRequestBody 是请求体的最大字节数，超出时返回 413。0 表示不限制。
+	MaxRequestBody int64
+}
+
+// LogConfig 是日志记录器的配置。
+type LogConfig struct {
+	// Level 是最低日志级别，例如 "debug"、"info"。
+	Level string
+
+	// Encoding 是 "json" 或 "console"。本地开发时 console 更易读，生产环境使用 json。
+	Encoding string
+}
+
+// ErrorsConfig 配置错误页面。模板是 html/template 格式的文件路径，留空时只输出 JSON。
+type ErrorsConfig struct {
+	NotFoundTemplate      string
+	InternalErrorTemplate string
+
+	// PanicMode 决定处理程序 panic 时的行为："recover" 返回 500，"crash" 记录堆栈后让进程崩溃，便于在开发环境中调试。
+	PanicMode string
+}
+
+// ClientConfig 是共享的出站 HTTP 客户端的配置。
+type ClientConfig struct {
+	// Timeout 是每个出站请求的总超时时间，0 表示不限制。
+	Timeout time.Duration
+
+	// DeadlineMargin 是出站请求相对入站请求截止时间提前结束的时间，用来给处理程序留出写响应的时间。
+	DeadlineMargin time.Duration
+
+	// UpstreamURL 是 /upstream 转发请求的地址，留空时不注册 /upstream，见 UpstreamHandler。
+	UpstreamURL string
+}
+
+// CacheConfig 是 CacheMiddleware 的配置。
+type CacheConfig struct {
+	// TTL 是响应被缓存的时间，0 表示不缓存。
+	TTL time.Duration
+
+	// MaxEntries 是缓存的最大条目数，超出时淘汰最久未使用的条目。
+	MaxEntries int
+
+	// MaxBodyBytes 是可以被缓存的最大响应体。
+	MaxBodyBytes int64
+}
+
+// AdminConfig 是运维接口（/admin/...）的配置。
+type AdminConfig struct {
+	// Addr 不为空时，运维接口由监听这个地址的独立服务器提供，不再出现在公共服务器上。
+	Addr string
+
+	// AllowedCIDRs 是允许访问运维接口的客户端地址范围，为空时不做限制。
+	AllowedCIDRs []string
+}
+
+// CompressionConfig 是响应压缩的配置。
+type CompressionConfig struct {
+	Enabled bool
+
+	// Level 是 gzip 的压缩级别，例如 gzip.BestSpeed、gzip.BestCompression，默认为 gzip.DefaultCompression。
+	Level int
+
+	// RatioWarning 是 gzip 请求体解压比（解压后/压缩后）的告警阈值，0 表示不告警。
+	// 普通的文本通常在 10 以内，远超这个数的请求多半是 zip 炸弹。
+	RatioWarning float64
+}
+
+// SlowRequestsConfig 配置慢请求记录。
+type SlowRequestsConfig struct {
+	// Threshold 是被视为慢请求的耗时，0 表示不记录。
+	Threshold time.Duration
+
+	// Samples 是 /debug/slow 保留的最近慢请求的个数。
+	Samples int
+}
+
+// DebugConfig 控制只应在非生产环境中使用的调试接口。
+type DebugConfig struct {
+	// Enabled 注册 /debug/ 下的所有接口，默认关闭，见 debugEnabled。
+	Enabled bool
+
+	// LogDependencyGraph 在启动时以 DOT 格式记录 Fx 的依赖关系图，帮助新成员了解组件是如何组装起来的。
+	LogDependencyGraph bool
+
+	// ServerTiming 打开 Server-Timing 响应头，见 NewServerTimingMiddleware。
+	ServerTiming bool
+
+	// LogsToken 是访问 /debug/logs 所需的 Bearer 令牌，留空时 /debug/logs 不可用。
+	LogsToken string `redact:"true"`
+
+	// LogsBuffer 是 /debug/logs 在内存中保留的最近日志的条数。
+	LogsBuffer int
+}
+
+// MaintenanceConfig 配置维护模式。
+type MaintenanceConfig struct {
+	// Enabled 时，如果 "routes" 组为空，所有请求都返回 503 和 Message，而不是 404，
+	// 让运维人员清楚地知道服务处于维护状态。
+	Enabled bool
+	Message string
+}
+
+// CSRFConfig 是 CSRFMiddleware 的配置。
+type CSRFConfig struct {
+	// CookieName 是保存令牌的 cookie 名。
+	CookieName string
+
+	// Secure 要求浏览器只通过 HTTPS 发送令牌 cookie，生产环境应当开启。
+	Secure bool
+}
+
+// RandomConfig 是 NewRand 的配置。
+type RandomConfig struct {
+	// Seed 是随机数生成器的种子，0 表示每次启动时随机选择。
+	Seed uint64
+}
+
+// AccessLogConfig 是访问日志的配置。
+type AccessLogConfig struct {
+	// Sampling 为 N 时每 N 个请求只记录一个，用于在高负载时减少日志量；0 或 1 表示全部记录。
+	// 状态码为 5xx 的请求总会被记录。
+	Sampling int
+}
+
+// FaviconConfig 是 /favicon.ico 的配置。
+type FaviconConfig struct {
+	// Path 是图标文件的路径，留空时 /favicon.ico 返回 204。
+	Path string
+}
+
+// WorkerConfig 是后台 Worker 的配置。
+type WorkerConfig struct {
+	// Interval 是两次执行任务之间的间隔。
+	Interval time.Duration
+
+	// TaskTimeout 是每次执行 WorkerTask 的超时时间，超时后任务的 context 被取消，0 表示不限制。
+	TaskTimeout time.Duration
+
+	// ReadyTimeout 是启动时等待 WorkerDependency 就绪的最长时间，ReadyBackoff 是第一次重试前的等待时间，之后每次加倍。
+	ReadyTimeout time.Duration
+	ReadyBackoff time.Duration
+}
+
+// LanguageConfig 是 AcceptLanguageMiddleware 的配置，语言使用 BCP 47 标签，例如 "en"、"zh-Hans"。
+type LanguageConfig struct {
+	// Default 是客户端没有声明语言或声明的语言都不受支持时使用的语言。
+	Default string
+
+	// Supported 是应用程序支持的其他语言。
+	Supported []string
+}
+
+// RequestIDConfig 配置携带请求 ID 的请求头和响应头。
+type RequestIDConfig struct {
+	// Headers 是读取上游请求 ID 的请求头，按优先级排列，例如 X-Request-ID、X-Correlation-ID。
+	Headers []string
+
+	// ResponseHeader 是写回请求 ID 的响应头。
+	ResponseHeader string
+}
+
+// HTTPSRedirectConfig 配置公共服务器的 HTTPS 重定向，见 NewHTTPSRedirectMiddleware。
+type HTTPSRedirectConfig struct {
+	// Enabled 打开重定向，默认关闭。
+	Enabled bool
+
+	// TrustedProxies 是可以信任其 X-Forwarded-Proto 请求头的反向代理的地址范围，例如 "10.0.0.0/8"。
+	TrustedProxies []string
+
+	// ExemptPaths 是不做重定向的路径，通常是负载均衡器通过 HTTP 访问的健康检查。
+	ExemptPaths []string
+}
+
+// HostValidationConfig 是 Host 头检查的配置，见 NewHostValidationMiddleware。
+type HostValidationConfig struct {
+	// AllowedHosts 是允许的主机名，例如 "example.com" 和 "*.example.com"，为空时不做检查。
+	AllowedHosts []string
+}
+
+// RateLimitConfig 是限流的初始参数，运行时可以通过 PUT /admin/ratelimit 修改，见 RateLimiter。
+type RateLimitConfig struct {
+	// Rate 是每个客户端每秒允许的请求数，0 表示不限流。
+	Rate float64
+
+	// Burst 是每个客户端最多可以连续发出的请求数。
+	Burst int
+}
+
+// UploadConfig 是 /upload 的配置。
+type UploadConfig struct {
+	// Dir 是保存上传文件的目录，留空时使用 os.TempDir。
+	Dir string
+
+	// MaxFileBytes 是单个文件的大小上限。
+	MaxFileBytes int64
+
+	// MaxBytes 是整个请求体的大小上限。
+	MaxBytes int64
+}
+
+// VHostConfig 是虚拟主机的配置，见 VHostMux。
+type VHostConfig struct {
+	// Hosts 把主机名（不含端口）映射到 AsVHostRoute 注册的路由组，例如 appOptions 中只有探针的 "status"，其余的主机名使用 "routes" 组。
+	Hosts map[string]string
+}
+
+// LifecycleConfig 是单个生命周期钩子的超时时间，见 WithHookTimeout。它们应该小于 Fx 整体的启动和停止超时（默认 15 秒），
+// 并且大于钩子内部的等待时间，例如 WorkerConfig.ReadyTimeout 和 ServerConfig.DrainTimeout。0 表示不限制。
+type LifecycleConfig struct {
+	StartHookTimeout time.Duration
+	StopHookTimeout  time.Duration
+}
+
+// WarmupConfig 是启动时缓存预热的配置，见 CacheWarmup。
+type WarmupConfig struct {
+	// Fatal 为 true 时，任何一个 CacheWarmer 失败都会让应用程序启动失败；默认只记录日志。
+	Fatal bool
+}
+
+// LatencyConfig 是请求延迟汇总日志的配置，见 LatencyReporter。
+type LatencyConfig struct {
+	// Interval 是两次汇总之间的间隔，0 表示不汇总。
+	Interval time.Duration
+}
+
+// EnvelopeConfig 配置 JSON 响应的公共字段，见 NewResponseEnvelopeMiddleware。
+type EnvelopeConfig struct {
+	// RequestID 为 JSON 对象响应加上 request_id 字段，默认关闭。
+	RequestID bool
+
+	// MaxBodyBytes 是会被缓冲和修改的响应体的上限，更大的响应原样透传。
+	MaxBodyBytes int64
+}
+
+// HealthConfig 是 /health 的配置。
+type HealthConfig struct {
+	// CheckTimeout 是每个 HealthChecker 的超时时间。
+	CheckTimeout time.Duration
+}
+
+// DocsConfig 是 /docs 的配置。
+type DocsConfig struct {
+	// Enabled 打开 Swagger UI，默认关闭。
+	Enabled bool
+
+	// SpecURL 是 Swagger UI 加载的 OpenAPI 文档的地址。
+	SpecURL string
+}
+
+// ConfigModule 提供整个应用程序共用的 *Config。它只构造一次，拆分出来的模块（HTTP、日志、指标等）都依赖它，
+// 而不是各自读取配置；需要修改配置的测试和嵌入方用 fx.Decorate(func(*Config) *Config) 替换它。
+// 只关心服务器配置的组件可以直接依赖 *ServerConfig，它指向 *Config 中的 Server 字段，不是副本。
+func ConfigModule() fx.Option {
+	return fx.Module("config",
+		fx.Provide(
+			NewConfig,
+			func(cfg *Config) *ServerConfig { return &cfg.Server },
+		),
+	)
+}
+
+// NewConfig 返回经过校验的默认配置。
+func NewConfig() (*Config, error) {
+	cfg := &Config{
+		Errors: ErrorsConfig{
+			PanicMode: PanicRecover,
+		},
+		Server: ServerConfig{
+			Network:           "tcp",
+			Addr:              ":8080",
+			LifecycleLogLevel: "info",
+			ListenAttempts:    1,
+			ListenBackoff:     250 * time.Millisecond,
+			KeepAlive: net.KeepAliveConfig{
+				Enable:   true,
+				Idle:     15 * time.Second,
+				Interval: 15 * time.Second,
+				Count:    9,
+			},
+			RequestTimeout: 5 * time.Second,
+			WriteTimeout:   60 * time.Second,
+			DrainTimeout:   10 * time.Second,
+			TrailingSlash:  TrailingSlashRedirect,
+			MaxQueryParams: 100,
+			MaxQueryLength: 4096,
+			MaxRequestBody: 10 << 20,
+		},
+		Log: LogConfig{
+			Level:    "info",
+			Encoding: "json",
+		},
+		Client: ClientConfig{
+			Timeout:        10 * time.Second,
+			DeadlineMargin: 100 * time.Millisecond,
+		},
+		Cache: CacheConfig{
+			TTL:          time.Minute,
+			MaxEntries:   1024,
+			MaxBodyBytes: 1 << 20,
+		},
+		Admin: AdminConfig{
+			AllowedCIDRs: []string{"127.0.0.0/8", "::1/128"},
+		},
+		Compression: CompressionConfig{
+			Enabled:      true,
+			Level:        gzip.DefaultCompression,
+			RatioWarning: 100,
+		},
+		CSRF: CSRFConfig{
+			CookieName: "csrf_token",
+		},
+		Maintenance: MaintenanceConfig{
+			Message: "Service is under maintenance",
+		},
+		Debug: DebugConfig{
+			LogsBuffer: 256,
+		},
+		RequestID: RequestIDConfig{
+			Headers:        []string{RequestIDHeader},
+			ResponseHeader: RequestIDHeader,
+		},
+		HTTPSRedirect: HTTPSRedirectConfig{
+			ExemptPaths: []string{"/readyz", "/health"},
+		},
+		RateLimit: RateLimitConfig{
+			Burst: 20,
+		},
+		Latency: LatencyConfig{
+			Interval: time.Minute,
+		},
+		Envelope: EnvelopeConfig{
+			MaxBodyBytes: 64 << 10,
+		},
+		Lifecycle: LifecycleConfig{
+			StartHookTimeout: 12 * time.Second,
+			StopHookTimeout:  12 * time.Second,
+		},
+		Upload: UploadConfig{
+			MaxFileBytes: 10 << 20,
+			MaxBytes:     32 << 20,
+		},
+		Health: HealthConfig{
+			CheckTimeout: 2 * time.Second,
+		},
+		Docs: DocsConfig{
+			SpecURL: "/docs.json",
+		},
+		Language: LanguageConfig{
+			Default:   "en",
+			Supported: []string{"zh", "fr"},
+		},
+		Worker: WorkerConfig{
+			Interval:     time.Minute,
+			TaskTimeout:  30 * time.Second,
+			ReadyTimeout: 10 * time.Second,
+			ReadyBackoff: 100 * time.Millisecond,
+		},
+		SlowRequests: SlowRequestsConfig{
+			Threshold: time.Second,
+			Samples:   32,
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate 校验配置，让错误的配置在启动时就暴露出来，而不是在处理请求时。
+func (c *Config) Validate() error {
+	if _, err := parseCIDRs(c.Admin.AllowedCIDRs); err != nil {
+		return fmt.Errorf("admin: %w", err)
+	}
+	if l := c.Compression.Level; l < gzip.HuffmanOnly || l > gzip.BestCompression {
+		return fmt.Errorf("compression: invalid gzip level %d", l)
+	}
+	if r := c.Compression.RatioWarning; r < 0 || math.IsNaN(r) {
+		return fmt.Errorf("compression: invalid ratio warning threshold %v", r)
+	}
+	if m := c.Errors.PanicMode; m != PanicRecover && m != PanicCrash {
+		return fmt.Errorf("errors: invalid panic mode %q", m)
+	}
+	if _, err := parseCIDRs(c.HTTPSRedirect.TrustedProxies); err != nil {
+		return fmt.Errorf("https redirect: %w", err)
+	}
+	if _, err := parseAllowedHosts(c.HostValidation.AllowedHosts); err != nil {
+		return fmt.Errorf("host validation: %w", err)
+	}
+	if c.CSRF.CookieName == "" {
+		return fmt.Errorf("csrf: cookie name is required")
+	}
+	if c.AccessLog.Sampling < 0 {
+		return fmt.Errorf("access log: negative sampling rate %d", c.AccessLog.Sampling)
+	}
+	if _, err := zapcore.ParseLevel(c.Server.LifecycleLogLevel); err != nil {
+		return fmt.Errorf("server: invalid lifecycle log level: %w", err)
+	}
+	if _, err := parseLanguages(c.Language); err != nil {
+		return fmt.Errorf("language: %w", err)
+	}
+	if err := (RateLimitSettings{Rate: c.RateLimit.Rate, Burst: c.RateLimit.Burst}).validate(); err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
+	if c.Worker.TaskTimeout < 0 {
+		return fmt.Errorf("worker: negative task timeout %v", c.Worker.TaskTimeout)
+	}
+	if c.Lifecycle.StartHookTimeout < 0 || c.Lifecycle.StopHookTimeout < 0 {
+		return fmt.Errorf("lifecycle: negative hook timeout")
+	}
+	if c.Upload.MaxFileBytes <= 0 || c.Upload.MaxBytes <= 0 {
+		return fmt.Errorf("upload: size limits must be positive")
+	}
+	if c.Health.CheckTimeout <= 0 {
+		return fmt.Errorf("health: check timeout must be positive")
+	}
+	if c.Worker.Interval <= 0 {
+		return fmt.Errorf("worker: interval must be positive")
+	}
+	if c.Worker.ReadyTimeout <= 0 || c.Worker.ReadyBackoff <= 0 {
+		return fmt.Errorf("worker: ready timeout and backoff must be positive")
+	}
+	if c.RequestID.ResponseHeader == "" {
+		return fmt.Errorf("request id: response header is required")
+	}
+	if c.Debug.LogsBuffer < 0 {
+		return fmt.Errorf("debug: negative log buffer size %d", c.Debug.LogsBuffer)
+	}
+	if c.Latency.Interval < 0 {
+		return fmt.Errorf("latency: negative interval %v", c.Latency.Interval)
+	}
+	if c.Envelope.RequestID && c.Envelope.MaxBodyBytes <= 0 {
+		return fmt.Errorf("envelope: max body size must be positive")
+	}
+	if u := c.Client.UpstreamURL; u != "" {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("client: invalid upstream URL %q", u)
+		}
+	}
+	if c.SlowRequests.Samples < 0 {
+		return fmt.Errorf("slow requests: negative sample count %d", c.SlowRequests.Samples)
+	}
+	return nil
+}
+
+// redactedValue 是敏感字段在输出中的替代值。
+const redactedValue = "***"
+
+// Redacted 把配置转换成适合输出的形式：字段名与 API 的其他部分一样使用 snake_case（RequestTimeout 写成 request_timeout），
+// 带 redact 标签的非零字段被替换为 "***"，time.Duration 输出为 "5s" 这样的字符串。
+func (c *Config) Redacted() any {
+	return redactValue(reflect.ValueOf(*c))
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+func redactValue(v reflect.Value) any {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]any, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := snakeCase(f.Name)
+			if f.Tag.Get("redact") == "true" && !v.Field(i).IsZero() {
+				out[name] = redactedValue
+				continue
+			}
+			out[name] = redactValue(v.Field(i))
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i))
+		}
+		return out
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem())
+	default:
+		return v.Interface()
+	}
+}
+
+// snakeCase 把 Go 的字段名转换成 snake_case，供 Redacted 使用，连续的大写字母作为一个词：UserID 写成 user_id，HTTPStatus 写成 http_status。
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
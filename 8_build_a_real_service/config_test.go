@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testConfig 返回默认配置，测试在此基础上修改需要的字段。
+func testConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+	return cfg
+}
+
+func TestConfigRedacted(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Debug.LogsToken = "secret"
+	out, ok := cfg.Redacted().(map[string]any)
+	if !ok {
+		t.Fatalf("Redacted() = %T, want map[string]any", cfg.Redacted())
+	}
+
+	section := func(name string) map[string]any {
+		t.Helper()
+		m, ok := out[name].(map[string]any)
+		if !ok {
+			t.Fatalf("Redacted()[%q] = %T, want a section; keys %v", name, out[name], out)
+		}
+		return m
+	}
+	tests := []struct {
+		name    string
+		section string
+		key     string
+		want    any
+	}{
+		{name: "snake case duration", section: "server", key: "request_timeout", want: "5s"},
+		{name: "snake case int", section: "server", key: "max_query_params", want: 100},
+		{name: "acronym", section: "request_id", key: "response_header", want: RequestIDHeader},
+		{name: "redacted", section: "debug", key: "logs_token", want: redactedValue},
+		{name: "nested struct", section: "server", key: "keep_alive", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := section(tt.section)[tt.key]
+			if !ok {
+				t.Fatalf("%s.%s missing; section %v", tt.section, tt.key, section(tt.section))
+			}
+			if tt.want != nil && got != tt.want {
+				t.Errorf("%s.%s = %v, want %v", tt.section, tt.key, got, tt.want)
+			}
+		})
+	}
+	if _, ok := out["Server"]; ok {
+		t.Error("Redacted() uses Go field names")
+	}
+}
+
+func TestConfigValidateWorkerReadiness(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		backoff time.Duration
+	}{
+		{name: "zero timeout", timeout: 0, backoff: time.Millisecond},
+		{name: "negative timeout", timeout: -time.Second, backoff: time.Millisecond},
+		{name: "zero backoff", timeout: time.Second, backoff: 0},
+		{name: "negative backoff", timeout: time.Second, backoff: -time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Worker.ReadyTimeout, cfg.Worker.ReadyBackoff = tt.timeout, tt.backoff
+			if err := cfg.Validate(); err == nil {
+				t.Error("Validate() = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+// CSRFRoute 是一个可选接口。CSRFProtected 返回 true 的路由（通常是 HTML 表单）受 CSRFMiddleware 保护。
+type CSRFRoute interface {
+	Route
+	CSRFProtected() bool
+}
+
+// CSRFMiddleware 使用双重提交 cookie 防止跨站请求伪造。NewRouter 只把它套在实现了 CSRFRoute 的路由上。
+type CSRFMiddleware Middleware
+
+// csrfHeader 和 csrfFormField 是提交令牌的两种方式：脚本使用请求头，HTML 表单使用隐藏字段。
+const (
+	csrfHeader    = "X-CSRF-Token"
+	csrfFormField = "csrf_token"
+)
+
+type csrfTokenKey struct{}
+
+// CSRFTokenFromContext 返回当前请求的 CSRF 令牌，表单页面把它放进名为 "csrf_token" 的隐藏字段。
+func CSRFTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(csrfTokenKey{}).(string)
+	return token
+}
+
+// NewCSRFMiddleware 在 cookie 中没有令牌时签发一个新令牌。GET、HEAD、OPTIONS 等安全方法不做检查；
+// 其他方法必须通过 X-CSRF-Token 请求头或 csrf_token 表单字段提交与 cookie 相同的令牌，否则返回 403。
+func NewCSRFMiddleware(cfg *Config, renderer *ErrorRenderer) CSRFMiddleware {
+	name := cfg.CSRF.CookieName
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+			if c, err := r.Cookie(name); err == nil && c.Value != "" {
+				token = c.Value
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			default:
+				submitted := r.Header.Get(csrfHeader)
+				if submitted == "" {
+					submitted = r.PostFormValue(csrfFormField)
+				}
+				if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(submitted)) != 1 {
+					renderer.Render(w, r, http.StatusForbidden, "invalid CSRF token")
+					return
+				}
+			}
+
+			if token == "" {
+				token = newCSRFToken()
+				http.SetCookie(w, &http.Cookie{
+					Name:     name,
+					Value:    token,
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   cfg.CSRF.Secure,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfTokenKey{}, token)))
+		})
+	}
+}
+
+func newCSRFToken() string {
+	var b [32]byte
+	rand.Read(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
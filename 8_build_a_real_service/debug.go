@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// StartTime 记录应用程序的启动时间。它在 OnStart 时才被设置，而不是在构造时，
+// 这样运行时间就不会把依赖注入的耗时算进去。
+type StartTime struct {
+	unixNano atomic.Int64
+}
+
+func NewStartTime(lc fx.Lifecycle) *StartTime {
+	st := &StartTime{}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			st.unixNano.Store(time.Now().UnixNano())
+			return nil
+		},
+	})
+	return st
+}
+
+// Uptime 返回自启动以来经过的时间；应用程序启动之前返回 0。
+func (st *StartTime) Uptime() time.Duration {
+	start := st.unixNano.Load()
+	if start == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, start))
+}
+
+// logDependencyGraph 在 DebugConfig.LogDependencyGraph 打开时记录 Fx 的依赖关系图。
+// 输出可以用 Graphviz 渲染：dot -Tsvg graph.dot -o graph.svg。
+func logDependencyGraph(cfg *Config, log *zap.Logger, graph fx.DotGraph) {
+	if !cfg.Debug.LogDependencyGraph {
+		return
+	}
+	log.Info("Dependency graph", zap.String("dot", string(graph)))
+}
+
+// StatsHandler 以 JSON 格式返回运行时和内存统计信息，用于快速诊断。
+type StatsHandler struct {
+	log   *zap.Logger
+	start *StartTime
+}
+
+func NewStatsHandler(log *zap.Logger, start *StartTime) *StatsHandler {
+	return &StatsHandler{log: log, start: start}
+}
+
+func (*StatsHandler) Pattern() string {
+	return "/debug/stats"
+}
+
+type memStats struct {
+	Alloc       uint64 `json:"alloc"`
+	TotalAlloc  uint64 `json:"total_alloc"`
+	Sys         uint64 `json:"sys"`
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapInuse   uint64 `json:"heap_inuse"`
+	HeapObjects uint64 `json:"heap_objects"`
+	NumGC       uint32 `json:"num_gc"`
+}
+
+type stats struct {
+	Goroutines    int      `json:"goroutines"`
+	Uptime        string   `json:"uptime"`
+	UptimeSeconds float64  `json:"uptime_seconds"`
+	Memory        memStats `json:"memory"`
+}
+
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	uptime := h.start.Uptime()
+	resp := stats{
+		Goroutines:    runtime.NumGoroutine(),
+		Uptime:        uptime.String(),
+		UptimeSeconds: uptime.Seconds(),
+		Memory: memStats{
+			Alloc:       m.Alloc,
+			TotalAlloc:  m.TotalAlloc,
+			Sys:         m.Sys,
+			HeapAlloc:   m.HeapAlloc,
+			HeapInuse:   m.HeapInuse,
+			HeapObjects: m.HeapObjects,
+			NumGC:       m.NumGC,
+		},
+	}
+
+	if err := WriteJSON(w, http.StatusOK, resp); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
+
+// ConfigHandler 以 JSON 格式返回生效的配置，敏感字段已被隐去，用于排查部署问题。
+type ConfigHandler struct {
+	log *zap.Logger
+	cfg *Config
+}
+
+func NewConfigHandler(log *zap.Logger, cfg *Config) *ConfigHandler {
+	return &ConfigHandler{log: log, cfg: cfg}
+}
+
+func (*ConfigHandler) Pattern() string {
+	return "/debug/config"
+}
+
+func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := writeJSON(w, http.StatusOK, h.cfg.Redacted(), true); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
+
+// GCHandler 在 POST /debug/gc 时强制执行一次垃圾回收，并返回回收前后的 HeapAlloc。
+type GCHandler struct {
+	log *zap.Logger
+}
+
+func NewGCHandler(log *zap.Logger) *GCHandler {
+	return &GCHandler{log: log}
+}
+
+func (*GCHandler) Pattern() string {
+	return "/debug/gc"
+}
+
+func (*GCHandler) Methods() []string {
+	return []string{http.MethodPost}
+}
+
+// 同时强制执行多次垃圾回收没有意义，只会让每个请求都等得更久。
+func (*GCHandler) MaxConcurrency() int {
+	return 1
+}
+
+type gcResult struct {
+	HeapAllocBefore uint64 `json:"heap_alloc_before"`
+	HeapAllocAfter  uint64 `json:"heap_alloc_after"`
+	Duration        string `json:"duration"`
+}
+
+func (h *GCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	runtime.GC()
+	d := time.Since(start)
+	runtime.ReadMemStats(&after)
+	h.log.Info("Forced garbage collection",
+		zap.Uint64("heap_alloc_before", before.HeapAlloc),
+		zap.Uint64("heap_alloc_after", after.HeapAlloc),
+		zap.Duration("duration", d),
+	)
+
+	resp := gcResult{HeapAllocBefore: before.HeapAlloc, HeapAllocAfter: after.HeapAlloc, Duration: d.String()}
+	if err := WriteJSON(w, http.StatusOK, resp); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
+
+// BuildInfoHandler 以 JSON 格式返回 runtime/debug.ReadBuildInfo 中的构建信息：Go 版本、主模块、依赖模块的版本，
+// 以及 vcs.revision 等构建设置。
+type BuildInfoHandler struct {
+	log      *zap.Logger
+	renderer *ErrorRenderer
+}
+
+func NewBuildInfoHandler(log *zap.Logger, renderer *ErrorRenderer) *BuildInfoHandler {
+	return &BuildInfoHandler{log: log, renderer: renderer}
+}
+
+func (*BuildInfoHandler) Pattern() string {
+	return "/debug/buildinfo"
+}
+
+type moduleInfo struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+	Replace string `json:"replace,omitempty"`
+}
+
+type buildInfo struct {
+	GoVersion string            `json:"go_version"`
+	Main      moduleInfo        `json:"main"`
+	Deps      []moduleInfo      `json:"deps"`
+	Settings  map[string]string `json:"settings"`
+}
+
+func newModuleInfo(m *debug.Module) moduleInfo {
+	info := moduleInfo{Path: m.Path, Version: m.Version, Sum: m.Sum}
+	if m.Replace != nil {
+		info.Replace = m.Replace.Path + "@" + m.Replace.Version
+	}
+	return info
+}
+
+func (h *BuildInfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		h.renderer.Render(w, r, http.StatusNotFound, "build information is not available")
+		return
+	}
+
+	resp := buildInfo{
+		GoVersion: bi.GoVersion,
+		Main:      newModuleInfo(&bi.Main),
+		Deps:      make([]moduleInfo, 0, len(bi.Deps)),
+		Settings:  make(map[string]string, len(bi.Settings)),
+	}
+	for _, dep := range bi.Deps {
+		resp.Deps = append(resp.Deps, newModuleInfo(dep))
+	}
+	for _, s := range bi.Settings {
+		resp.Settings[s.Key] = s.Value
+	}
+
+	if err := WriteJSON(w, http.StatusOK, resp); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
+
+// sensitiveHeaders 是 /debug/headers 中会被替换为 "***" 的请求头。
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Csrf-Token", "X-Api-Key"}
+
+// HeadersHandler 以 JSON 格式返回收到的请求头，用来排查代理和客户端的问题。Host 不在 r.Header 中，单独加入。
+// 凭据类的请求头会被替换为 "***"。
+type HeadersHandler struct {
+	log *zap.Logger
+}
+
+func NewHeadersHandler(log *zap.Logger) *HeadersHandler {
+	return &HeadersHandler{log: log}
+}
+
+func (*HeadersHandler) Pattern() string {
+	return "/debug/headers"
+}
+
+func (h *HeadersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	headers := r.Header.Clone()
+	headers.Set("Host", r.Host)
+	for _, name := range sensitiveHeaders {
+		if values, ok := headers[name]; ok {
+			for i := range values {
+				values[i] = redactedValue
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err := writeJSON(w, http.StatusOK, headers, true); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ErrorRenderer 负责输出错误响应。客户端更偏好 text/html 且配置了对应状态码的模板时渲染 HTML，否则输出 JSON。
+// 所有错误响应都使用同一种 JSON 格式：{"status": 404, "error": "Not Found", "code": "not_found", "message": "..."}。
+type ErrorRenderer struct {
+	log       *zap.Logger
+	templates map[int]*template.Template
+}
+
+// errorPage 是传给错误页面模板的数据。
+type errorPage struct {
+	Status     int
+	StatusText string
+	Code       string
+	Message    string
+}
+
+// NewErrorRenderer 在启动时解析配置的模板，模板有误时应用程序不会启动。
+func NewErrorRenderer(log *zap.Logger, cfg *Config) (*ErrorRenderer, error) {
+	files := map[int]string{
+		http.StatusNotFound:            cfg.Errors.NotFoundTemplate,
+		http.StatusInternalServerError: cfg.Errors.InternalErrorTemplate,
+	}
+	templates := make(map[int]*template.Template)
+	for status, file := range files {
+		if file == "" {
+			continue
+		}
+		tmpl, err := template.ParseFiles(file)
+		if err != nil {
+			return nil, fmt.Errorf("parse %d error page template: %w", status, err)
+		}
+		templates[status] = tmpl
+	}
+	return &ErrorRenderer{log: log, templates: templates}, nil
+}
+
+// Render 输出一个状态码为 status 的错误响应，错误码由状态码得出，见 statusCode。
+func (er *ErrorRenderer) Render(w http.ResponseWriter, r *http.Request, status int, message string) {
+	er.render(w, r, status, statusCode(status), message)
+}
+
+// RenderError 按 HTTPError 的状态码、错误码和消息输出错误响应。HTTPError 没有错误码时与 Render 相同。
+func (er *ErrorRenderer) RenderError(w http.ResponseWriter, r *http.Request, herr *HTTPError) {
+	code := herr.Code
+	if code == "" {
+		code = statusCode(herr.Status)
+	}
+	er.render(w, r, herr.Status, code, herr.Message)
+}
+
+// statusCode 返回状态码对应的默认错误码，例如 404 对应 "not_found"。
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+func (er *ErrorRenderer) render(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	page := errorPage{Status: status, StatusText: http.StatusText(status), Code: code, Message: message}
+
+	if tmpl, ok := er.templates[status]; ok && prefersHTML(r.Header.Get("Accept")) {
+		// 先渲染到缓冲区，模板执行失败时还能退回 JSON。
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, page)
+		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(status)
+			buf.WriteTo(w)
+			return
+		}
+		er.log.Error("Failed to render error page", zap.Int("status", status), zap.Error(err))
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	resp := struct {
+		Status  int    `json:"status"`
+		Error   string `json:"error"`
+		Code    string `json:"code"`
+		Message string `json:"message,omitempty"`
+	}{Status: status, Error: page.StatusText, Code: code, Message: message}
+	if err := WriteJSON(w, status, resp); err != nil {
+		er.log.Error("Failed to write response", zap.Error(err))
+	}
+}
+
+// prefersHTML 报告 Accept 头是否更偏好 text/html 而不是 application/json。
+// 两者权重相同（例如 "*/*"）时选择 JSON。
+func prefersHTML(accept string) bool {
+	return acceptQuality(accept, "text/html") > acceptQuality(accept, "application/json")
+}
+
+// acceptQuality 返回 Accept 头中与 mediaType 匹配的最具体的媒体范围的 q 值。
+func acceptQuality(accept, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	best, bestSpecificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		rng := strings.ToLower(strings.TrimSpace(params[0]))
+
+		specificity := -1
+		switch rng {
+		case mediaType:
+			specificity = 2
+		case typ + "/*":
+			specificity = 1
+		case "*/*":
+			specificity = 0
+		}
+		if specificity < 0 || specificity < bestSpecificity {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		best, bestSpecificity = q, specificity
+	}
+	return best
+}
+
+// notFoundHandler 在路由器没有匹配的路由时，用 ErrorRenderer 输出 404，而不是路由器自己的纯文本页面。
+func notFoundHandler(mux Router, renderer *ErrorRenderer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mux.Match(r) == "" {
+			renderer.Render(w, r, http.StatusNotFound, "")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// panic 的处理方式，见 ErrorsConfig.PanicMode。
+const (
+	PanicRecover = "recover"
+	PanicCrash   = "crash"
+)
+
+// NewRecoveryMiddleware 捕获处理程序和其他中间件中的 panic，记录堆栈，并用 ErrorRenderer 返回 500。
+// NewChain 总是把它放在最外层，请求的日志记录器还不在 context 中，所以请求 ID 从 RequestIDMiddleware 写出的响应头中读取。
+// PanicMode 为 "crash" 时，记录堆栈后重新 panic。net/http 会捕获处理程序 goroutine 中的 panic，
+// 所以要在新的 goroutine 中 panic 才能让进程崩溃。
+func NewRecoveryMiddleware(log *zap.Logger, cfg *Config, renderer *ErrorRenderer) Wrapper {
+	crash := cfg.Errors.PanicMode == PanicCrash
+	respHeader := cfg.RequestID.ResponseHeader
+	return Named("recovery", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				// http.ErrAbortHandler 用于有意中断响应，交给 net/http 处理。
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				log.Error("Recovered from panic",
+					zap.String("request_id", w.Header().Get(respHeader)),
+					zap.Any("panic", p),
+					zap.String("method", r.Method),
+					zap.String("url", r.URL.String()),
+					zap.ByteString("stack", debug.Stack()),
+				)
+				if crash {
+					log.Sync()
+					go func() { panic(p) }()
+					// 进程即将退出，不再写响应。
+					select {}
+				}
+				renderer.Render(w, r, http.StatusInternalServerError, "")
+			}()
+			next.ServeHTTP(w, r)
+		})
+	})
+}
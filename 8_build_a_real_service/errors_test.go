@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// testRenderer 返回一个没有配置模板的 ErrorRenderer，它总是输出 JSON。
+func testRenderer(t *testing.T) *ErrorRenderer {
+	t.Helper()
+	renderer, err := NewErrorRenderer(zap.NewNop(), testConfig(t))
+	if err != nil {
+		t.Fatalf("NewErrorRenderer() error = %v", err)
+	}
+	return renderer
+}
+
+// errorEnvelope 是 ErrorRenderer 输出的 JSON 错误响应。
+type errorEnvelope struct {
+	Status  int    `json:"status"`
+	Error   string `json:"error"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// decodeError 解析响应中的错误信封，并检查它的状态码与响应的状态码一致。
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) errorEnvelope {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var env errorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("decode error response %q: %v", rec.Body.String(), err)
+	}
+	if env.Status != rec.Code {
+		t.Errorf("envelope status = %d, response status = %d", env.Status, rec.Code)
+	}
+	return env
+}
+
+func TestErrorRendererRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		message string
+		want    errorEnvelope
+	}{
+		{name: "not found", status: http.StatusNotFound, want: errorEnvelope{Status: 404, Error: "Not Found", Code: "not_found"}},
+		{name: "with message", status: http.StatusBadRequest, message: "invalid host", want: errorEnvelope{Status: 400, Error: "Bad Request", Code: "bad_request", Message: "invalid host"}},
+		{name: "multi word status", status: http.StatusTooManyRequests, want: errorEnvelope{Status: 429, Error: "Too Many Requests", Code: "too_many_requests"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			testRenderer(t).Render(rec, httptest.NewRequest(http.MethodGet, "/", nil), tt.status, tt.message)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := decodeError(t, rec); got != tt.want {
+				t.Errorf("envelope = %+v, want %+v", got, tt.want)
+			}
+			if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+			}
+		})
+	}
+}
+
+func TestErrorRendererRenderError(t *testing.T) {
+	tests := []struct {
+		name string
+		herr *HTTPError
+		want errorEnvelope
+	}{
+		{
+			name: "explicit code",
+			herr: &HTTPError{Status: http.StatusRequestEntityTooLarge, Code: "body_too_large", Message: "Request body too large"},
+			want: errorEnvelope{Status: 413, Error: "Request Entity Too Large", Code: "body_too_large", Message: "Request body too large"},
+		},
+		{
+			name: "default code",
+			herr: &HTTPError{Status: http.StatusBadRequest, Message: "bad"},
+			want: errorEnvelope{Status: 400, Error: "Bad Request", Code: "bad_request", Message: "bad"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			testRenderer(t).RenderError(rec, httptest.NewRequest(http.MethodGet, "/", nil), tt.herr)
+			if got := decodeError(t, rec); got != tt.want {
+				t.Errorf("envelope = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorRendererTemplate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "404.html")
+	if err := os.WriteFile(file, []byte("<p>{{.Status}} {{.Code}} {{.Message}}</p>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t)
+	cfg.Errors.NotFoundTemplate = file
+	renderer, err := NewErrorRenderer(zap.NewNop(), cfg)
+	if err != nil {
+		t.Fatalf("NewErrorRenderer() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		accept   string
+		status   int
+		wantType string
+		wantBody string
+	}{
+		{name: "html", accept: "text/html", status: http.StatusNotFound, wantType: "text/html; charset=utf-8", wantBody: "<p>404 not_found gone</p>"},
+		{name: "json preferred", accept: "application/json, text/html;q=0.5", status: http.StatusNotFound, wantType: "application/json"},
+		{name: "no template for status", accept: "text/html", status: http.StatusBadRequest, wantType: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			renderer.Render(rec, req, tt.status, "gone")
+
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPrefersHTML(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "*/*", want: false},
+		{accept: "text/html", want: true},
+		{accept: "text/html,application/xhtml+xml,*/*;q=0.8", want: true},
+		{accept: "application/json", want: false},
+		{accept: "text/*;q=0.9, application/json;q=0.5", want: true},
+	}
+	for _, tt := range tests {
+		if got := prefersHTML(tt.accept); got != tt.want {
+			t.Errorf("prefersHTML(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// 所有直接输出错误的处理程序和中间件都使用同一种错误信封。
+func TestErrorEnvelopeCallSites(t *testing.T) {
+	renderer := testRenderer(t)
+	allowlist, err := IPAllowlistMiddleware([]string{"10.0.0.0/8"}, renderer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gc := NewGCHandler(zap.NewNop())
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		req     *http.Request
+		want    errorEnvelope
+	}{
+		{
+			name:    "allowlist",
+			handler: allowlist(http.NotFoundHandler()),
+			req:     httptest.NewRequest(http.MethodGet, "/admin/drain", nil),
+			want:    errorEnvelope{Status: 403, Error: "Forbidden", Code: "forbidden"},
+		},
+		{
+			name:    "method not allowed",
+			handler: allowMethods(gc, gc.Methods(), renderer)(gc),
+			req:     httptest.NewRequest(http.MethodGet, "/debug/gc", nil),
+			want:    errorEnvelope{Status: 405, Error: "Method Not Allowed", Code: "method_not_allowed"},
+		},
+		{
+			name:    "readyz",
+			handler: NewReadyzHandler(&ReadinessProbe{}, renderer),
+			req:     httptest.NewRequest(http.MethodGet, "/readyz", nil),
+			want:    errorEnvelope{Status: 503, Error: "Service Unavailable", Code: "service_unavailable", Message: "not ready"},
+		},
+		{
+			name:    "stream",
+			handler: NewStreamHandler(zap.NewNop(), &StreamRegistry{}, context.Background(), renderer),
+			req:     httptest.NewRequest(http.MethodGet, "/stream?count=0", nil),
+			want:    errorEnvelope{Status: 400, Error: "Bad Request", Code: "bad_request", Message: "count must be a positive integer"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, tt.req)
+			if got := decodeError(t, rec); got != tt.want {
+				t.Errorf("envelope = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
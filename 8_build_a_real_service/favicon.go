@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FaviconHandler 响应浏览器自动发出的 /favicon.ico 请求，避免它们变成日志里的 404。
+// 配置了 FaviconConfig.Path 时返回该文件，否则返回 204。
+type FaviconHandler struct {
+	icon        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// NewFaviconHandler 在启动时读取图标，文件不存在时应用程序不会启动。
+func NewFaviconHandler(cfg *Config) (*FaviconHandler, error) {
+	path := cfg.Favicon.Path
+	if path == "" {
+		return &FaviconHandler{}, nil
+	}
+	icon, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("favicon: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("favicon: %w", err)
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(icon)
+	}
+	return &FaviconHandler{icon: icon, contentType: contentType, modTime: info.ModTime()}, nil
+}
+
+func (*FaviconHandler) Pattern() string {
+	return "/favicon.ico"
+}
+
+func (h *FaviconHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.icon == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", h.contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	// ServeContent 负责 HEAD、Range 和 If-Modified-Since。
+	http.ServeContent(w, r, "favicon.ico", h.modTime, bytes.NewReader(h.icon))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// echoFormTemplate 是 /echo/form 的页面，csrf_token 隐藏字段的值来自 CSRFTokenFromContext。
+var echoFormTemplate = template.Must(template.ParseFS(staticFiles, "static/echo_form.html"))
+
+// EchoFormHandler 是 /echo 的 HTML 表单版本：GET 返回表单，POST 把 text 字段显示在表单下方。
+// 它是 CSRFRoute，POST 必须带上与 cookie 相同的 csrf_token，见 NewCSRFMiddleware。
+type EchoFormHandler struct {
+	handler http.Handler
+}
+
+func NewEchoFormHandler(log *zap.Logger, renderer *ErrorRenderer) *EchoFormHandler {
+	h := &EchoFormHandler{}
+	h.handler = HandleErrors(log, renderer, h.serve)
+	return h
+}
+
+func (*EchoFormHandler) Pattern() string {
+	return "/echo/form"
+}
+
+func (*EchoFormHandler) Methods() []string {
+	return []string{http.MethodGet, http.MethodPost}
+}
+
+func (*EchoFormHandler) CSRFProtected() bool {
+	return true
+}
+
+func (h *EchoFormHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *EchoFormHandler) serve(w http.ResponseWriter, r *http.Request) *HTTPError {
+	page := struct{ CSRFToken, Text string }{CSRFToken: CSRFTokenFromContext(r.Context())}
+	if r.Method == http.MethodPost {
+		page.Text = r.PostFormValue("text")
+	}
+
+	var buf bytes.Buffer
+	if err := echoFormTemplate.Execute(&buf, page); err != nil {
+		return &HTTPError{
+			Status:  http.StatusInternalServerError,
+			Code:    "render_failed",
+			Message: "Failed to render page",
+			Err:     err,
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := buf.WriteTo(w); err != nil {
+		return &HTTPError{
+			Status:  http.StatusInternalServerError,
+			Code:    "write_failed",
+			Message: "Failed to write response",
+			Err:     err,
+		}
+	}
+	return nil
+}
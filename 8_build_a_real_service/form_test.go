@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// build 只把 CSRFMiddleware 套在 CSRFRoute 上：/echo/form 的 POST 需要令牌，/echo 不需要。
+func TestEchoFormCSRF(t *testing.T) {
+	cfg := testConfig(t)
+	renderer := testRenderer(t)
+	p := testRouterParams(t, cfg,
+		NewEchoFormHandler(zap.NewNop(), renderer),
+		NewEchoHandler(zap.NewNop(), renderer),
+	)
+	p.CSRF = NewCSRFMiddleware(cfg, renderer)
+	mux, err := p.build("main", p.Routes)
+	if err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+
+	// 先用 GET 取得令牌的 cookie。
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/echo/form", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /echo/form status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == cfg.CSRF.CookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatalf("GET /echo/form set no %s cookie", cfg.CSRF.CookieName)
+	}
+	if !strings.Contains(rec.Body.String(), `value="`+cookie.Value+`"`) {
+		t.Errorf("form does not contain the CSRF token %q:\n%s", cookie.Value, rec.Body)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		cookie   bool
+		token    string
+		want     int
+		wantBody string
+	}{
+		{name: "valid token", target: "/echo/form", cookie: true, token: cookie.Value, want: http.StatusOK, wantBody: "&lt;b&gt;hi&lt;/b&gt;"},
+		{name: "missing token", target: "/echo/form", cookie: true, want: http.StatusForbidden},
+		{name: "wrong token", target: "/echo/form", cookie: true, token: "forged", want: http.StatusForbidden},
+		{name: "missing cookie", target: "/echo/form", token: cookie.Value, want: http.StatusForbidden},
+		{name: "route without CSRFRoute", target: "/echo", want: http.StatusOK, wantBody: "text=%3Cb%3Ehi%3C%2Fb%3E"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"text": {"<b>hi</b>"}}
+			if tt.token != "" {
+				form.Set(csrfFormField, tt.token)
+			}
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie {
+				r.AddCookie(cookie)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body %q", rec.Code, tt.want, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %q:\n%s", tt.wantBody, rec.Body)
+			}
+		})
+	}
+}
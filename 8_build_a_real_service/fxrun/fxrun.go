@@ -0,0 +1,122 @@
+// Package fxrun 提供在 fx.App.Run 之外运行应用程序的辅助函数：限定运行时长、跟随外层 context 停止，
+// 以及在嵌入到更大的程序中时使用的 RunBlocking。使用它们的应用程序必须提供 *zap.Logger。
+package fxrun
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// RunFor 让应用程序在启动 d 之后通过 fx.Shutdowner 自行停止，用于 CI 冒烟测试和演示。
+// 在此之前应用程序如果已经因为其他原因停止，计时器会被取消。
+func RunFor(d time.Duration) fx.Option {
+	return fx.Invoke(func(lc fx.Lifecycle, shutdowner fx.Shutdowner, log *zap.Logger) {
+		done := make(chan struct{})
+		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				go func() {
+					timer := time.NewTimer(d)
+					defer timer.Stop()
+					select {
+					case <-timer.C:
+						log.Info("Run duration elapsed, shutting down", zap.Duration("duration", d))
+						if err := shutdowner.Shutdown(); err != nil {
+							log.Error("Failed to shut down", zap.Error(err))
+						}
+					case <-done:
+					}
+				}()
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				close(done)
+				return nil
+			},
+		})
+	})
+}
+
+// ParentContext 是外层程序传给应用程序的 context，见 WithParentContext。
+type ParentContext struct {
+	context.Context
+}
+
+// WithParentContext 用 fx.Supply 提供 ParentContext，并在它被取消时通过 fx.Shutdowner 优雅地停止应用程序。
+// 应用程序嵌入在一个自己管理 context 的更大的程序中时使用它，它与信号处理并存，哪个先发生都会触发关闭。
+func WithParentContext(parent context.Context) fx.Option {
+	return fx.Options(
+		fx.Supply(ParentContext{parent}),
+		fx.Invoke(func(lc fx.Lifecycle, shutdowner fx.Shutdowner, log *zap.Logger, parent ParentContext) {
+			done := make(chan struct{})
+			lc.Append(fx.Hook{
+				OnStart: func(ctx context.Context) error {
+					go func() {
+						select {
+						case <-parent.Done():
+							log.Info("Parent context cancelled, shutting down", zap.Error(context.Cause(parent)))
+							if err := shutdowner.Shutdown(); err != nil {
+								log.Error("Failed to shut down", zap.Error(err))
+							}
+						case <-done:
+						}
+					}()
+					return nil
+				},
+				OnStop: func(ctx context.Context) error {
+					close(done)
+					return nil
+				},
+			})
+		}),
+	)
+}
+
+// PublishServer 把应用程序提供的 *http.Server 写入 *holder，用于嵌入的场景：外层程序可以读取它的地址，或者在启动后直接使用它。
+// 它就是 fx.Populate，写入发生在 fx.New 期间，此时服务器还没有开始监听。
+func PublishServer(holder **http.Server) fx.Option {
+	return fx.Populate(holder)
+}
+
+// ExitCodeError 是 RunBlocking 在应用程序以非零退出码（fx.ExitCode）停止时返回的错误。
+type ExitCodeError struct {
+	Code int
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("application stopped with exit code %d", e.Code)
+}
+
+// RunBlocking 是嵌入场景下的 fx.App.Run：它启动 app，等待关闭信号、fx.Shutdowner 或 ctx 被取消，然后停止 app，
+// 直到所有 OnStop 钩子执行完才返回。它不会调用 os.Exit，启动和停止的错误都作为返回值交给调用方。
+// 启动和停止分别使用 app.StartTimeout() 和 app.StopTimeout()。ctx 被取消既不会中断正在进行的启动，也不会中断停止：
+// 取消传给 fx.App.Start 的 context 会让 Fx 跳过启动失败时的回滚，启动过程中的中断应当交给 OnStart 钩子自己处理。
+// 启动完成时 ctx 已经被取消的，应用程序随即停止。
+func RunBlocking(ctx context.Context, app *fx.App) error {
+	startCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), app.StartTimeout())
+	defer cancel()
+	if err := app.Start(startCtx); err != nil {
+		return err
+	}
+
+	var code int
+	select {
+	case sig := <-app.Wait():
+		code = sig.ExitCode
+	case <-ctx.Done():
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), app.StopTimeout())
+	defer cancel()
+	if err := app.Stop(stopCtx); err != nil {
+		return err
+	}
+	if code != 0 {
+		return &ExitCodeError{Code: code}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package fxrun
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// newApp 返回一个提供了 *zap.Logger 的应用程序，opts 是测试需要的其他选项。
+func newApp(opts ...fx.Option) *fx.App {
+	return fx.New(fx.NopLogger, fx.Supply(zap.NewNop()), fx.Options(opts...))
+}
+
+func TestRunBlocking(t *testing.T) {
+	errStart := errors.New("start failed")
+	tests := []struct {
+		name     string
+		opts     func(cancel context.CancelFunc) fx.Option
+		wantErr  error
+		wantCode int
+	}{
+		{
+			name: "context cancelled",
+			opts: func(cancel context.CancelFunc) fx.Option {
+				return fx.Invoke(func(lc fx.Lifecycle) {
+					lc.Append(fx.StartHook(func() { cancel() }))
+				})
+			},
+		},
+		{
+			name: "run for",
+			opts: func(context.CancelFunc) fx.Option { return RunFor(10 * time.Millisecond) },
+		},
+		{
+			name: "shutdown with exit code",
+			opts: func(context.CancelFunc) fx.Option {
+				return fx.Invoke(func(lc fx.Lifecycle, s fx.Shutdowner) {
+					lc.Append(fx.StartHook(func() error { return s.Shutdown(fx.ExitCode(3)) }))
+				})
+			},
+			wantCode: 3,
+		},
+		{
+			name: "start error",
+			opts: func(context.CancelFunc) fx.Option {
+				return fx.Invoke(func(lc fx.Lifecycle) {
+					lc.Append(fx.StartHook(func() error { return errStart }))
+				})
+			},
+			wantErr: errStart,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// 这个钩子先于 tt.opts 的钩子注册，启动失败时也会被回滚。
+			stopped := false
+			app := newApp(fx.Invoke(func(lc fx.Lifecycle) {
+				lc.Append(fx.StopHook(func() { stopped = true }))
+			}), tt.opts(cancel))
+
+			errc := make(chan error, 1)
+			go func() { errc <- RunBlocking(ctx, app) }()
+			var err error
+			select {
+			case err = <-errc:
+			case <-time.After(5 * time.Second):
+				t.Fatal("RunBlocking did not return")
+			}
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("RunBlocking() = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantCode != 0:
+				var exitErr *ExitCodeError
+				if !errors.As(err, &exitErr) || exitErr.Code != tt.wantCode {
+					t.Errorf("RunBlocking() = %v, want exit code %d", err, tt.wantCode)
+				}
+			case err != nil:
+				t.Errorf("RunBlocking() = %v, want nil", err)
+			}
+			if !stopped {
+				t.Error("OnStop hooks did not run")
+			}
+		})
+	}
+}
+
+// 传给 RunBlocking 的 context 在启动期间被取消时，启动照常完成，随后应用程序停止。
+func TestRunBlockingCancelledDuringStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var startErr error
+	app := newApp(fx.Invoke(func(lc fx.Lifecycle) {
+		lc.Append(fx.StartHook(func(ctx context.Context) {
+			cancel()
+			startErr = ctx.Err()
+		}))
+	}))
+	if err := RunBlocking(ctx, app); err != nil {
+		t.Fatalf("RunBlocking() = %v, want nil", err)
+	}
+	if startErr != nil {
+		t.Errorf("start context error = %v, want nil", startErr)
+	}
+}
+
+func TestWithParentContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	var got ParentContext
+	app := newApp(WithParentContext(parent), fx.Populate(&got))
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got.Context != parent {
+		t.Error("ParentContext is not the parent context")
+	}
+
+	cancel()
+	select {
+	case <-app.Wait():
+	case <-time.After(5 * time.Second):
+		t.Fatal("application did not shut down after the parent context was cancelled")
+	}
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishServer(t *testing.T) {
+	want := &http.Server{Addr: "127.0.0.1:0"}
+	var got *http.Server
+	app := newApp(fx.Supply(want), PublishServer(&got))
+	if err := app.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("PublishServer wrote %p, want %p", got, want)
+	}
+}
+
+func TestExitCodeError(t *testing.T) {
+	if got, want := (&ExitCodeError{Code: 2}).Error(), "application stopped with exit code 2"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
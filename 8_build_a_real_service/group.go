@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// GroupContext 是应用程序范围的 *errgroup.Group 的 context。组里任何一个 goroutine 返回错误，
+// 或者应用程序开始停止时，它都会被取消。通过 *errgroup.Group 启动的 goroutine 应该在它被取消后尽快返回。
+type GroupContext context.Context
+
+// errGroupStopped 是应用程序正常停止时 GroupContext 被取消的原因。
+var errGroupStopped = errors.New("background group stopped")
+
+// NewErrGroup 提供一个应用程序范围的 *errgroup.Group，用来协调需要共同取消的后台 goroutine。
+// 组里的 goroutine 返回错误时，其余的 goroutine 通过 GroupContext 得知需要停止，应用程序也会通过 fx.Shutdowner
+// 以退出码 1 优雅地停止。OnStop 取消 GroupContext 并等待组里的 goroutine 全部返回。
+func NewErrGroup(lc fx.Lifecycle, shutdowner fx.Shutdowner, log *zap.Logger) (*errgroup.Group, GroupContext) {
+	parent, stop := context.WithCancelCause(context.Background())
+	g, ctx := errgroup.WithContext(parent)
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				select {
+				case <-ctx.Done():
+					// 应用程序正常停止时，ctx 的原因是 errGroupStopped。
+					if err := context.Cause(ctx); !errors.Is(err, errGroupStopped) {
+						log.Error("Background task failed, shutting down", zap.Error(err))
+						if err := shutdowner.Shutdown(fx.ExitCode(1)); err != nil {
+							log.Error("Failed to shut down", zap.Error(err))
+						}
+					}
+				case <-done:
+				}
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			close(done)
+			stop(errGroupStopped)
+			waited := make(chan struct{})
+			go func() {
+				// 导致关闭的错误已经记录过了，这里不再返回它。
+				g.Wait()
+				close(waited)
+			}()
+			select {
+			case <-waited:
+				return nil
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+		},
+	})
+	return g, ctx
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+)
+
+type EchoHandler struct {
+	handler http.Handler
+}
+
+func NewEchoHandler(log *zap.Logger, renderer *ErrorRenderer) *EchoHandler {
+	h := &EchoHandler{}
+	h.handler = HandleErrors(log, renderer, h.serve)
+	return h
+}
+
+func (*EchoHandler) Pattern() string {
+	return "/echo"
+}
+
+// 上传的内容可能很大，/echo 需要比默认值更长的超时时间。
+func (*EchoHandler) Timeout() time.Duration {
+	return 30 * time.Second
+}
+
+// /echo 接受比默认上限更大的上传。
+func (*EchoHandler) MaxBodyBytes() int64 {
+	return 64 << 20
+}
+
+func (h *EchoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+// serve 先读完整个请求体再写响应。读取中途失败（例如客户端断开）时还没有写出任何内容，
+// 客户端得到的是错误响应，而不是状态码为 200 的半截内容。请求体的大小由 BodyLimitMiddleware 限制。
+func (h *EchoHandler) serve(w http.ResponseWriter, r *http.Request) *HTTPError {
+	body, herr := readBody(r)
+	if herr != nil {
+		return herr
+	}
+	if _, err := w.Write(body); err != nil {
+		return &HTTPError{
+			Status:  http.StatusInternalServerError,
+			Code:    "write_failed",
+			Message: "Failed to write response",
+			Err:     err,
+		}
+	}
+	AddLogField(r.Context(), "echo_bytes", len(body))
+	LoggerFromContext(r.Context()).Debug("Echoed request body", zap.Int("bytes", len(body)))
+	return nil
+}
+
+// readBody 读取整个请求体。失败时返回的 HTTPError 在日志中带有已读取的字节数和错误类型，
+// 用来区分请求体过大、客户端中途断开和其他读取错误。
+func readBody(r *http.Request) ([]byte, *HTTPError) {
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		return body, nil
+	}
+
+	herr := &HTTPError{
+		Status:  http.StatusBadRequest,
+		Code:    "read_failed",
+		Message: "Failed to read request",
+		Err:     err,
+		Fields: []zap.Field{
+			zap.Int("bytes_read", len(body)),
+			zap.String("error_type", fmt.Sprintf("%T", err)),
+		},
+	}
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		herr.Status = http.StatusRequestEntityTooLarge
+		herr.Code = "body_too_large"
+		herr.Message = "Request body too large"
+	} else if errors.Is(err, io.ErrUnexpectedEOF) {
+		herr.Code = "body_truncated"
+		herr.Message = "Request body ended unexpectedly"
+	}
+	return nil, herr
+}
+
+// HelloHandler is an HTTP handler that
+// prints a greeting to the user.
+type HelloHandler struct {
+	handler http.Handler
+}
+
+// NewHelloHandler builds a new HelloHandler.
+func NewHelloHandler(log *zap.Logger, renderer *ErrorRenderer) *HelloHandler {
+	h := &HelloHandler{}
+	h.handler = HandleErrors(log, renderer, h.serve)
+	return h
+}
+
+func (*HelloHandler) Pattern() string {
+	return "/hello"
+}
+
+// /hello 只需要一个名字。
+func (*HelloHandler) MaxBodyBytes() int64 {
+	return 4 << 10
+}
+
+func (h *HelloHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+// serve 只需要返回错误，响应和日志由 HandleErrors 负责。
+func (h *HelloHandler) serve(w http.ResponseWriter, r *http.Request) *HTTPError {
+	body, herr := readBody(r)
+	if herr != nil {
+		return herr
+	}
+
+	tag := LanguageFromContext(r.Context())
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	addVary(w.Header(), "Accept-Language")
+	if _, err := fmt.Fprintf(w, greeting(tag), body); err != nil {
+		return &HTTPError{
+			Status:  http.StatusInternalServerError,
+			Code:    "write_failed",
+			Message: "Failed to write response",
+			Err:     err,
+		}
+	}
+	AddLogField(r.Context(), "language", tag.String())
+	LoggerFromContext(r.Context()).Debug("Greeted caller", zap.String("language", tag.String()))
+	return nil
+}
+
+// greetings 是按语言本地化的问候语，键是语言的基本子标签。
+var greetings = map[string]string{
+	"en": "Hello, %s\n",
+	"zh": "你好，%s\n",
+	"fr": "Bonjour, %s\n",
+}
+
+// greeting 返回 tag 对应的问候语，没有对应的翻译时使用英语。
+func greeting(tag language.Tag) string {
+	base, _ := tag.Base()
+	if g, ok := greetings[base.String()]; ok {
+		return g
+	}
+	return greetings["en"]
+}
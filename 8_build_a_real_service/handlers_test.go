@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Inasayang/fxdemo/8_build_a_real_service/internal/logtest"
+	"golang.org/x/text/language"
+)
+
+func TestEchoHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		limit      int64
+		wantStatus int
+		wantBody   string
+		wantLog    string
+	}{
+		{name: "echo", body: "hello", wantStatus: http.StatusOK, wantBody: "hello", wantLog: "Echoed request body"},
+		{name: "empty", body: "", wantStatus: http.StatusOK, wantBody: "", wantLog: "Echoed request body"},
+		{name: "too large", body: "hello", limit: 2, wantStatus: http.StatusRequestEntityTooLarge, wantLog: "Request body too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, logs := logtest.NewObservedLogger()
+			h := NewLoggingMiddleware(log, testConfig(t)).Wrap(NewEchoHandler(log, testRenderer(t)))
+
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			if tt.limit > 0 {
+				req.Body = http.MaxBytesReader(rec, req.Body, tt.limit)
+			}
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if n := logs.FilterMessage(tt.wantLog).Len(); n != 1 {
+				t.Errorf("got %d %q log entries, want 1; all entries: %v", n, tt.wantLog, logs.All())
+			}
+		})
+	}
+}
+
+func TestEchoHandlerLogFields(t *testing.T) {
+	log, logs := logtest.NewObservedLogger()
+	h := NewLoggingMiddleware(log, testConfig(t)).Wrap(NewEchoHandler(log, testRenderer(t)))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello")))
+
+	success := logs.FilterMessage("Echoed request body").All()
+	if len(success) != 1 {
+		t.Fatalf("got %d success entries, want 1", len(success))
+	}
+	if got := success[0].ContextMap()["bytes"]; got != int64(5) {
+		t.Errorf("bytes = %v, want 5", got)
+	}
+	access := logs.FilterMessage("Request completed").All()
+	if len(access) != 1 {
+		t.Fatalf("got %d access log entries, want 1", len(access))
+	}
+	if got := access[0].ContextMap()["echo_bytes"]; got != int64(5) {
+		t.Errorf("access log echo_bytes = %v, want 5", got)
+	}
+}
+
+func TestHelloHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      language.Tag
+		body     string
+		wantBody string
+		wantLang string
+	}{
+		{name: "default", tag: language.Und, body: "fx", wantBody: "Hello, fx\n", wantLang: "und"},
+		{name: "chinese", tag: language.Chinese, body: "fx", wantBody: "你好，fx\n", wantLang: "zh"},
+		{name: "french", tag: language.French, body: "fx", wantBody: "Bonjour, fx\n", wantLang: "fr"},
+		{name: "untranslated", tag: language.German, body: "fx", wantBody: "Hello, fx\n", wantLang: "de"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, logs := logtest.NewObservedLogger()
+			h := NewLoggingMiddleware(log, testConfig(t)).Wrap(NewHelloHandler(log, testRenderer(t)))
+
+			req := httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), languageKey{}, tt.tag))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Values("Vary"); len(got) != 1 || got[0] != "Accept-Language" {
+				t.Errorf("Vary = %q, want [Accept-Language]", got)
+			}
+			access := logs.FilterMessage("Request completed").All()
+			if len(access) != 1 || access[0].ContextMap()["language"] != tt.wantLang {
+				t.Errorf("access log = %v, want language=%q", access, tt.wantLang)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ReadinessProbe 保存应用程序是否准备好接收流量。负载均衡器通过 /readyz 读取它。
+// 生命周期（启动完成、开始关闭）由 SetReady 设置，Drainer 的摘除状态由 SetDraining 单独设置，
+// 两者都允许时才算就绪，所以恢复流量不会让还没启动完成或者正在关闭的实例变为就绪。
+type ReadinessProbe struct {
+	ready    atomic.Bool
+	draining atomic.Bool
+}
+
+func NewReadinessProbe() *ReadinessProbe {
+	return &ReadinessProbe{}
+}
+
+func (p *ReadinessProbe) SetReady(ready bool) {
+	p.ready.Store(ready)
+}
+
+func (p *ReadinessProbe) SetDraining(draining bool) {
+	p.draining.Store(draining)
+}
+
+func (p *ReadinessProbe) Ready() bool {
+	return p.ready.Load() && !p.draining.Load()
+}
+
+// ProbeRoute 是一个可选接口。Probe 返回 true 的路由是探针，缓存预热期间也照常响应，见 NewWarmupGateMiddleware。
+type ProbeRoute interface {
+	Route
+	Probe() bool
+}
+
+func isProbeRoute(route Route) bool {
+	r, ok := routeAs[ProbeRoute](route)
+	return ok && r.Probe()
+}
+
+// ReadyzHandler 在应用程序就绪时返回 200，否则返回 503。
+type ReadyzHandler struct {
+	probe    *ReadinessProbe
+	renderer *ErrorRenderer
+}
+
+func NewReadyzHandler(probe *ReadinessProbe, renderer *ErrorRenderer) *ReadyzHandler {
+	return &ReadyzHandler{probe: probe, renderer: renderer}
+}
+
+func (*ReadyzHandler) Pattern() string {
+	return "/readyz"
+}
+
+func (*ReadyzHandler) Probe() bool {
+	return true
+}
+
+func (h *ReadyzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.probe.Ready() {
+		h.renderer.Render(w, r, http.StatusServiceUnavailable, "not ready")
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
+
+// HealthChecker 检查一个依赖（数据库、缓存、上游服务等）是否可用，Check 返回 nil 表示可用。
+// 实现放入 "health_checkers" 组，见 AsHealthChecker。
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// AsHealthChecker 和 AsRoute 类似：它把构造函数的结果作为 HealthChecker 放入 "health_checkers" 组。
+func AsHealthChecker(f any) any {
+	return fx.Annotate(
+		f,
+		fx.As(new(HealthChecker)),
+		fx.ResultTags(`group:"health_checkers"`),
+	)
+}
+
+type healthParams struct {
+	fx.In
+
+	Log      *zap.Logger
+	Config   *Config
+	Checkers []HealthChecker `group:"health_checkers"`
+}
+
+// HealthHandler 在 /health 并发执行所有 HealthChecker，以 JSON 返回每个依赖的状态。
+// 任何一个检查失败或超过 HealthConfig.CheckTimeout 时，整体状态为 unhealthy，状态码为 503。
+// 全部检查的耗时以 "health" 出现在 Server-Timing 中，见 AddServerTiming。
+type HealthHandler struct {
+	log      *zap.Logger
+	timeout  time.Duration
+	checkers []HealthChecker
+}
+
+func NewHealthHandler(p healthParams) *HealthHandler {
+	return &HealthHandler{log: p.Log, timeout: p.Config.Health.CheckTimeout, checkers: p.Checkers}
+}
+
+func (*HealthHandler) Pattern() string {
+	return "/health"
+}
+
+func (*HealthHandler) Probe() bool {
+	return true
+}
+
+type healthStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type healthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]healthStatus `json:"checks"`
+}
+
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := healthReport{Status: "healthy", Checks: make(map[string]healthStatus, len(h.checkers))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	checksStart := time.Now()
+	for _, c := range h.checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+			defer cancel()
+			start := time.Now()
+			err := c.Check(ctx)
+			s := healthStatus{Status: "healthy", Duration: time.Since(start).String()}
+			if err != nil {
+				s.Status, s.Error = "unhealthy", err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.Name()] = s
+			if err != nil {
+				report.Status = "unhealthy"
+			}
+		}()
+	}
+	wg.Wait()
+	AddServerTiming(r.Context(), "health", time.Since(checksStart))
+
+	status := http.StatusOK
+	if report.Status != "healthy" {
+		status = http.StatusServiceUnavailable
+		loggerFrom(r.Context(), h.log).Warn("Health check failed", zap.Any("checks", report.Checks))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := WriteJSON(w, status, report); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
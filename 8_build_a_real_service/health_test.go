@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testChecker 是返回固定结果的 HealthChecker。
+type testChecker struct {
+	name string
+	err  error
+}
+
+func (c testChecker) Name() string {
+	return c.name
+}
+
+func (c testChecker) Check(context.Context) error {
+	return c.err
+}
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		serverTiming bool
+		checkers     []HealthChecker
+		wantStatus   int
+		wantTiming   bool
+	}{
+		{
+			name:       "healthy",
+			checkers:   []HealthChecker{testChecker{name: "db"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unhealthy",
+			checkers:   []HealthChecker{testChecker{name: "db"}, testChecker{name: "cache", err: errors.New("down")}},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:         "server timing",
+			serverTiming: true,
+			checkers:     []HealthChecker{testChecker{name: "db"}},
+			wantStatus:   http.StatusOK,
+			wantTiming:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Debug.ServerTiming = tt.serverTiming
+			cfg.Health.CheckTimeout = time.Second
+			h := NewServerTimingMiddleware(cfg)(NewHealthHandler(healthParams{
+				Log:      zap.NewNop(),
+				Config:   cfg,
+				Checkers: tt.checkers,
+			}))
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			timing := rec.Header().Get("Server-Timing")
+			if got := strings.Contains(timing, "health;dur="); got != tt.wantTiming {
+				t.Errorf("Server-Timing = %q, want health entry %v", timing, tt.wantTiming)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// errHookTimeout 是超过 LifecycleConfig 中的超时时间时，钩子的 context 被取消的原因。
+var errHookTimeout = errors.New("lifecycle hook timed out")
+
+// WithHookTimeout 给钩子的 OnStart 和 OnStop 分别加上 LifecycleConfig.StartHookTimeout 和 StopHookTimeout 的超时，
+// 这样一个慢的钩子不会耗尽整个应用程序的启动或停止时间。超时后钩子的 context 被取消，WithHookTimeout 记录一条带有
+// 钩子名字的 error 级别日志并返回错误，而不再等待钩子返回；不理会 context 的钩子会继续在后台运行。超时为 0 时不做限制。
+func WithHookTimeout(log *zap.Logger, cfg *Config, name string, hook fx.Hook) fx.Hook {
+	if hook.OnStart != nil {
+		hook.OnStart = hookTimeout(log, name, "OnStart", cfg.Lifecycle.StartHookTimeout, hook.OnStart)
+	}
+	if hook.OnStop != nil {
+		hook.OnStop = hookTimeout(log, name, "OnStop", cfg.Lifecycle.StopHookTimeout, hook.OnStop)
+	}
+	return hook
+}
+
+func hookTimeout(log *zap.Logger, name, phase string, timeout time.Duration, f func(context.Context) error) func(context.Context) error {
+	if timeout <= 0 {
+		return f
+	}
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeoutCause(ctx, timeout, errHookTimeout)
+		defer cancel()
+		done := make(chan error, 1)
+		go func() {
+			done <- f(ctx)
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			if !errors.Is(context.Cause(ctx), errHookTimeout) {
+				// Fx 自己的启动或停止超时先到了，由 Fx 报告。
+				return ctx.Err()
+			}
+			log.Error("Lifecycle hook timed out", zap.String("hook", name), zap.String("phase", phase), zap.Duration("timeout", timeout))
+			return fmt.Errorf("%s %s: %w after %v", name, phase, errHookTimeout, timeout)
+		}
+	}
+}
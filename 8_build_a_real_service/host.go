@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/fx"
+)
+
+// allowedHosts 是 HostValidationConfig.AllowedHosts 解析后的结果。
+type allowedHosts struct {
+	exact    map[string]bool
+	suffixes []string // "*.example.com" 保存为 ".example.com"
+}
+
+// parseAllowedHosts 解析允许的主机名。"*.example.com" 匹配 example.com 的任意一级或多级子域名，但不匹配 example.com 本身，
+// 需要时两者都要列出；通配符只能出现在最左边。主机名按 normalizeHost 的规则比较，不区分大小写，忽略端口。
+func parseAllowedHosts(hosts []string) (*allowedHosts, error) {
+	a := &allowedHosts{exact: make(map[string]bool)}
+	for _, host := range hosts {
+		if rest, ok := strings.CutPrefix(host, "*."); ok {
+			if rest == "" || strings.Contains(rest, "*") {
+				return nil, fmt.Errorf("invalid wildcard host %q", host)
+			}
+			a.suffixes = append(a.suffixes, "."+normalizeHost(rest))
+			continue
+		}
+		if host == "" || strings.Contains(host, "*") {
+			return nil, fmt.Errorf("invalid host %q: only a leading \"*.\" wildcard is supported", host)
+		}
+		a.exact[normalizeHost(host)] = true
+	}
+	return a, nil
+}
+
+func (a *allowedHosts) allows(host string) bool {
+	host = normalizeHost(host)
+	if host == "" {
+		return false
+	}
+	if a.exact[host] {
+		return true
+	}
+	for _, suffix := range a.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+type hostValidationParams struct {
+	fx.In
+
+	Config      *Config
+	Renderer    *ErrorRenderer
+	Router      Router
+	Routes      []Route      `group:"routes"`
+	VHostRoutes []vhostRoute `group:"vhost_routes"`
+}
+
+// NewHostValidationMiddleware 拒绝 Host 头不在 HostValidationConfig.AllowedHosts 中的请求，包括没有 Host 头的请求，返回 400。
+// 应用程序用 Host 生成重定向地址和链接时，伪造的 Host 会把用户引到攻击者的站点，或者污染缓存。
+// 负载均衡器的健康检查通常直接访问实例的 IP，所以探针（ProbeRoute）不受限制。AllowedHosts 为空时不做检查。
+// 它必须位于 HTTPSRedirectMiddleware 之外，后者用 Host 生成重定向地址。
+func NewHostValidationMiddleware(p hostValidationParams) (Middleware, error) {
+	allowed, err := parseAllowedHosts(p.Config.HostValidation.AllowedHosts)
+	if err != nil {
+		return nil, err
+	}
+	probes := newRouteLookup(p.Router, p.Routes, p.VHostRoutes, routeIs(isProbeRoute))
+	return func(next http.Handler) http.Handler {
+		if len(p.Config.HostValidation.AllowedHosts) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if allowed.allows(r.Host) || probes.has(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			p.Renderer.Render(w, r, http.StatusBadRequest, "invalid host")
+		})
+	}, nil
+}
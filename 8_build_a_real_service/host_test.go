@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostValidationMiddleware(t *testing.T) {
+	routes := []Route{probeRoute{pattern: "/health"}, limitedRoute{pattern: "/echo"}}
+	mux := NewRouterProvider().NewRouter()
+	for _, route := range routes {
+		mux.Handle(route.Pattern(), route)
+	}
+	mw, err := NewHostValidationMiddleware(hostValidationParams{
+		Config:   &Config{HostValidation: HostValidationConfig{AllowedHosts: []string{"example.com", "*.example.org"}}},
+		Renderer: testRenderer(t),
+		Router:   mux,
+		Routes:   routes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(mux)
+
+	tests := []struct {
+		name       string
+		host       string
+		target     string
+		wantStatus int
+	}{
+		{name: "allowed", host: "example.com", target: "/echo", wantStatus: http.StatusOK},
+		{name: "case, port and trailing dot ignored", host: "Example.COM.:8080", target: "/echo", wantStatus: http.StatusOK},
+		{name: "disallowed", host: "evil.com", target: "/echo", wantStatus: http.StatusBadRequest},
+		{name: "missing host", host: "", target: "/echo", wantStatus: http.StatusBadRequest},
+		{name: "wildcard subdomain", host: "api.example.org", target: "/echo", wantStatus: http.StatusOK},
+		{name: "wildcard nested subdomain", host: "a.b.example.org", target: "/echo", wantStatus: http.StatusOK},
+		{name: "wildcard excludes bare domain", host: "example.org", target: "/echo", wantStatus: http.StatusBadRequest},
+		{name: "probe exempt", host: "10.0.0.1:8080", target: "/health", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestParseAllowedHostsRejectsMalformed(t *testing.T) {
+	for _, host := range []string{"", "*.", "*.*.example.com", "api.*.example.com"} {
+		if _, err := parseAllowedHosts([]string{host}); err == nil {
+			t.Errorf("parseAllowedHosts(%q) error = nil, want an error", host)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// HTTPError 描述一个处理程序返回给客户端的错误。
+// Status 是 HTTP 状态码，Code 是稳定的、供机器读取的错误码，Message 会返回给客户端，
+// Err 是内部原因，Fields 是额外的日志字段，它们只写入日志。
+type HTTPError struct {
+	Status  int
+	Code    string
+	Message string
+	Err     error
+	Fields  []zap.Field
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// HandlerFunc 是可以返回 *HTTPError 的处理函数，返回 nil 表示处理成功。
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) *HTTPError
+
+// HandleErrors 把 HandlerFunc 适配成 http.Handler，集中负责记录日志，并用 ErrorRenderer 把错误转换成响应。
+// 如果处理函数在出错前已经开始写响应，就只记录日志。
+func HandleErrors(log *zap.Logger, renderer *ErrorRenderer, fn HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := newStatusWriter(w)
+		herr := fn(sw, r)
+		if herr == nil {
+			return
+		}
+		log := loggerFrom(r.Context(), log)
+
+		fields := []zap.Field{
+			zap.Int("status", herr.Status),
+			zap.String("code", herr.Code),
+			zap.String("method", r.Method),
+			zap.String("url", r.URL.String()),
+			zap.Error(herr.Err),
+		}
+		fields = append(fields, herr.Fields...)
+		if herr.Status >= 500 {
+			log.Error(herr.Message, fields...)
+		} else {
+			log.Warn(herr.Message, fields...)
+		}
+
+		if sw.status != 0 {
+			return
+		}
+		renderer.RenderError(w, r, herr)
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Inasayang/fxdemo/8_build_a_real_service/internal/logtest"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestHandleErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		fn        HandlerFunc
+		wantCode  int
+		wantBody  *errorEnvelope
+		wantLevel zapcore.Level
+		wantLogs  int
+	}{
+		{
+			name:     "success",
+			fn:       func(w http.ResponseWriter, r *http.Request) *HTTPError { w.Write([]byte("ok")); return nil },
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "client error",
+			fn: func(w http.ResponseWriter, r *http.Request) *HTTPError {
+				return &HTTPError{Status: http.StatusBadRequest, Code: "invalid_cursor", Message: "Invalid cursor"}
+			},
+			wantCode:  http.StatusBadRequest,
+			wantBody:  &errorEnvelope{Status: 400, Error: "Bad Request", Code: "invalid_cursor", Message: "Invalid cursor"},
+			wantLevel: zapcore.WarnLevel,
+			wantLogs:  1,
+		},
+		{
+			name: "server error",
+			fn: func(w http.ResponseWriter, r *http.Request) *HTTPError {
+				return &HTTPError{Status: http.StatusInternalServerError, Code: "write_failed", Message: "Failed to write response", Err: errors.New("boom")}
+			},
+			wantCode:  http.StatusInternalServerError,
+			wantBody:  &errorEnvelope{Status: 500, Error: "Internal Server Error", Code: "write_failed", Message: "Failed to write response"},
+			wantLevel: zapcore.ErrorLevel,
+			wantLogs:  1,
+		},
+		{
+			name: "response already started",
+			fn: func(w http.ResponseWriter, r *http.Request) *HTTPError {
+				w.WriteHeader(http.StatusAccepted)
+				return &HTTPError{Status: http.StatusInternalServerError, Code: "write_failed", Message: "Failed to write response"}
+			},
+			wantCode:  http.StatusAccepted,
+			wantLevel: zapcore.ErrorLevel,
+			wantLogs:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, logs := logtest.NewObservedLogger()
+			rec := httptest.NewRecorder()
+			HandleErrors(log, testRenderer(t), tt.fn).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantBody != nil {
+				if got := decodeError(t, rec); got != *tt.wantBody {
+					t.Errorf("envelope = %+v, want %+v", got, *tt.wantBody)
+				}
+			}
+			if logs.Len() != tt.wantLogs {
+				t.Fatalf("got %d log entries, want %d", logs.Len(), tt.wantLogs)
+			}
+			if tt.wantLogs > 0 && logs.All()[0].Level != tt.wantLevel {
+				t.Errorf("log level = %v, want %v", logs.All()[0].Level, tt.wantLevel)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// NewHTTPSRedirectMiddleware 在 HTTPSRedirectConfig.Enabled 时把 HTTP 请求以 301 重定向到对应的 https:// 地址。
+// 请求是否使用 HTTPS 由 TLS 连接判断；来自 TrustedProxies 的请求改用 X-Forwarded-Proto，其他客户端伪造的该请求头会被忽略。
+// ExemptPaths 中的路径（例如负载均衡器的健康检查）和运维服务器上的请求不做重定向。
+func NewHTTPSRedirectMiddleware(cfg *Config) (Middleware, error) {
+	rc := cfg.HTTPSRedirect
+	proxies, err := parseCIDRs(rc.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	adminAddr := cfg.Admin.Addr
+	return func(next http.Handler) http.Handler {
+		if !rc.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			srv, _ := r.Context().Value(http.ServerContextKey).(*http.Server)
+			onAdmin := srv != nil && adminAddr != "" && srv.Addr == adminAddr
+			if onAdmin || isHTTPS(r, proxies) || slices.Contains(rc.ExemptPaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// 重定向地址使用 RequestURI（路径和查询参数），主机取自 Host 请求头。
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		})
+	}, nil
+}
+
+// isHTTPS 报告客户端是否通过 HTTPS 发出请求。
+func isHTTPS(r *http.Request, proxies []netip.Prefix) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !allowed(proxies, r) {
+		return false
+	}
+	// 经过多层代理时取第一个值，它是离客户端最近的代理写入的。
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
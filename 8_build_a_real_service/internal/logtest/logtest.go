@@ -0,0 +1,14 @@
+// Package logtest 提供测试中断言日志输出的辅助函数。
+package logtest
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// NewObservedLogger 返回一个记录所有级别日志的 *zap.Logger，以及用于查询这些日志的 *observer.ObservedLogs。
+func NewObservedLogger() (*zap.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return zap.New(core), logs
+}
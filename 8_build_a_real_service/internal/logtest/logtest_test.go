@@ -0,0 +1,21 @@
+package logtest
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewObservedLogger(t *testing.T) {
+	log, logs := NewObservedLogger()
+	log.Debug("debug message", zap.String("k", "v"))
+	log.Error("error message")
+
+	if got := logs.Len(); got != 2 {
+		t.Fatalf("logs.Len() = %d, want 2", got)
+	}
+	entry := logs.FilterMessage("debug message").All()
+	if len(entry) != 1 || entry[0].ContextMap()["k"] != "v" {
+		t.Errorf("debug entry = %+v, want one entry with k=v", entry)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// InvokeStep 和 fx.Invoke 一样调用 f，但 f 返回错误时，先以 error 级别记录一条带有步骤名和函数名的日志，
+// 再把加上步骤名的错误交给 Fx。启动时的迁移、预热之类的步骤失败时，原因不会淹没在 Fx 的启动日志里。
+// f 的最后一个返回值必须是 error；不返回错误的函数直接交给 fx.Invoke。
+func InvokeStep(step string, f any) fx.Option {
+	fv := reflect.ValueOf(f)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumOut() == 0 || ft.Out(ft.NumOut()-1) != errorType {
+		return fx.Invoke(f)
+	}
+	name := runtime.FuncForPC(fv.Pointer()).Name()
+
+	// 在 f 的参数之前插入 *zap.Logger，用来记录错误。它放在最前面，这样变参函数包装之后仍然是变参，
+	// Fx 会像对待 f 本身一样把最后的切片参数当作可选的。
+	in := make([]reflect.Type, 0, ft.NumIn()+1)
+	in = append(in, loggerType)
+	for i := 0; i < ft.NumIn(); i++ {
+		in = append(in, ft.In(i))
+	}
+	out := make([]reflect.Type, ft.NumOut())
+	for i := range out {
+		out[i] = ft.Out(i)
+	}
+
+	wrapped := reflect.MakeFunc(reflect.FuncOf(in, out, ft.IsVariadic()), func(args []reflect.Value) []reflect.Value {
+		log := args[0].Interface().(*zap.Logger)
+		args = args[1:]
+		var results []reflect.Value
+		if ft.IsVariadic() {
+			results = fv.CallSlice(args)
+		} else {
+			results = fv.Call(args)
+		}
+		last := len(results) - 1
+		if err, _ := results[last].Interface().(error); err != nil {
+			log.Error("Startup step failed", zap.String("step", step), zap.String("function", name), zap.Error(err))
+			results[last] = reflect.ValueOf(fmt.Errorf("%s: %w", step, err))
+		}
+		return results
+	})
+	return fx.Invoke(wrapped.Interface())
+}
+
+var (
+	errorType  = reflect.TypeFor[error]()
+	loggerType = reflect.TypeFor[*zap.Logger]()
+)
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Inasayang/fxdemo/8_build_a_real_service/internal/logtest"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var errMigrate = errors.New("migration failed")
+
+func migrate(cfg *Config) error { return errMigrate }
+
+func TestInvokeStep(t *testing.T) {
+	log, logs := logtest.NewObservedLogger()
+	app := fx.New(
+		fx.NopLogger,
+		fx.Supply(log, &Config{}),
+		InvokeStep("migrate", migrate),
+	)
+
+	err := app.Err()
+	if !errors.Is(err, errMigrate) {
+		t.Fatalf("app.Err() = %v, want %v", err, errMigrate)
+	}
+	if !strings.Contains(err.Error(), "migrate: migration failed") {
+		t.Errorf("app.Err() = %q, want it to contain the step name", err)
+	}
+	entries := logs.FilterMessage("Startup step failed").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d failure log entries, want 1; all entries: %v", len(entries), logs.All())
+	}
+	fields := entries[0].ContextMap()
+	if fields["step"] != "migrate" || !strings.HasSuffix(fields["function"].(string), ".migrate") {
+		t.Errorf("log fields = %v, want step=migrate and the function name", fields)
+	}
+}
+
+func TestInvokeStepPassesThrough(t *testing.T) {
+	var called []string
+	app := fx.New(
+		fx.NopLogger,
+		fx.Supply(zap.NewNop()),
+		InvokeStep("plain", func() { called = append(called, "plain") }),
+		InvokeStep("variadic", func(names ...string) error {
+			called = append(called, "variadic")
+			return nil
+		}),
+	)
+	if err := app.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(called, ","); got != "plain,variadic" {
+		t.Errorf("called = %q, want plain,variadic", got)
+	}
+}
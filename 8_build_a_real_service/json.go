@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// WriteJSON 以 status 写出 v 的 JSON，所有处理程序都用它输出 JSON。编码由 encoding/json 完成，
+// 字段名来自结构体的 json 标签：响应和请求中的结构体要为每个导出的字段写明 snake_case 的 json 标签，
+// 可以省略的字段加上 omitempty。Codecs 的其他格式也使用这些标签，换一种格式，客户端看到的结构不变。
+//
+// 编码失败时什么都不写，调用方可以改为返回错误响应。
+func WriteJSON(w http.ResponseWriter, status int, v any) error {
+	return writeJSON(w, status, v, false)
+}
+
+// writeJSON 与 WriteJSON 相同，indent 为 true 时输出缩进的 JSON，供主要由人阅读的调试接口使用。
+func writeJSON(w http.ResponseWriter, status int, v any, indent bool) error {
+	var body []byte
+	var err error
+	if indent {
+		body, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		body, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(append(body, '\n'))
+	return err
+}
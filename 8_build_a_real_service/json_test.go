@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteJSON(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		v      any
+		indent bool
+		want   string
+	}{
+		{
+			name: "tag names and omitempty",
+			v:    SlowRequest{Time: at, Method: "GET", Path: "/x", Route: "/x", Status: 200, Duration: 1500 * time.Millisecond},
+			want: `{"time":"2026-01-02T03:04:05Z","method":"GET","path":"/x","route":"/x","status":200,"duration_ns":1500000000}` + "\n",
+		},
+		{
+			name: "omitempty field present",
+			v:    RouteInfo{Router: "main", Pattern: "/x", Handler: "*main.X", Methods: []string{"GET"}},
+			want: `{"router":"main","pattern":"/x","handler":"*main.X","methods":["GET"]}` + "\n",
+		},
+		{
+			name:   "indent",
+			v:      map[string]int{"a": 1},
+			indent: true,
+			want:   "{\n  \"a\": 1\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if err := writeJSON(rec, http.StatusTeapot, tt.v, tt.indent); err != nil {
+				t.Fatalf("writeJSON() error = %v", err)
+			}
+			if rec.Code != http.StatusTeapot {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusTeapot)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if rec.Body.String() != tt.want {
+				t.Errorf("body = %s, want %s", rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if err := WriteJSON(rec, http.StatusOK, make(chan int)); err == nil {
+		t.Fatal("WriteJSON() error = nil, want an error")
+	}
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+		t.Errorf("WriteJSON wrote a response on error: %q", rec.Body.String())
+	}
+}
+
+// apiTypes 是作为 JSON 或其他 Codec 格式出现在请求和响应中的结构体。
+var apiTypes = []any{
+	SlowRequest{}, RouteInfo{}, RouteStats{}, RateLimitSettings{}, Item{}, itemPage{},
+	uploadedFile{}, serverTime{}, healthStatus{}, healthReport{}, stats{}, memStats{},
+	gcResult{}, buildInfo{}, moduleInfo{},
+}
+
+// 每个导出的字段都要有 snake_case 的 json 标签，见 WriteJSON。
+func TestAPITypesHaveJSONTags(t *testing.T) {
+	for _, v := range apiTypes {
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if !f.IsExported() || f.Anonymous {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" {
+				t.Errorf("%s.%s has no json tag", typ.Name(), f.Name)
+				continue
+			}
+			if name != "-" && name != snakeCase(name) {
+				t.Errorf("%s.%s json tag %q is not snake_case", typ.Name(), f.Name, name)
+			}
+		}
+	}
+}
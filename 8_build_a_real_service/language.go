@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+type languageKey struct{}
+
+// LanguageFromContext 返回 AcceptLanguageMiddleware 为当前请求选出的语言，不在请求中时返回 language.Und。
+func LanguageFromContext(ctx context.Context) language.Tag {
+	tag, ok := ctx.Value(languageKey{}).(language.Tag)
+	if !ok {
+		return language.Und
+	}
+	return tag
+}
+
+// parseLanguages 解析 LanguageConfig，返回的列表以默认语言开头，language.Matcher 在没有匹配时使用它。
+func parseLanguages(cfg LanguageConfig) ([]language.Tag, error) {
+	def, err := language.Parse(cfg.Default)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default language %q: %w", cfg.Default, err)
+	}
+	tags := []language.Tag{def}
+	for _, s := range cfg.Supported {
+		tag, err := language.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid language %q: %w", s, err)
+		}
+		if tag != def {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// NewAcceptLanguageMiddleware 按 Accept-Language 从 LanguageConfig.Supported 中选出最合适的语言放进 context，
+// 请求头缺失、无法解析或没有匹配的语言时使用 LanguageConfig.Default。
+func NewAcceptLanguageMiddleware(cfg *Config) (Middleware, error) {
+	tags, err := parseLanguages(cfg.Language)
+	if err != nil {
+		return nil, err
+	}
+	matcher := language.NewMatcher(tags)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tag := tags[0]
+			if accept := r.Header.Get("Accept-Language"); accept != "" {
+				// ParseAcceptLanguage 出错时 prefs 为空，Match 返回默认语言。
+				prefs, _, _ := language.ParseAcceptLanguage(accept)
+				_, i, conf := matcher.Match(prefs...)
+				if conf != language.No {
+					tag = tags[i]
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), languageKey{}, tag)))
+		})
+	}, nil
+}
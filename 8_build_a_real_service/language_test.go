@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+)
+
+func TestAcceptLanguageMiddleware(t *testing.T) {
+	cfg := &Config{Language: LanguageConfig{Default: "en", Supported: []string{"zh", "fr"}}}
+	mw, err := NewAcceptLanguageMiddleware(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		accept string
+		want   language.Tag
+	}{
+		{accept: "fr", want: language.French},
+		{accept: "fr-CA, en;q=0.5", want: language.French},
+		{accept: "de, zh;q=0.8", want: language.Chinese},
+		{accept: "de", want: language.English},
+		{accept: "", want: language.English},
+		{accept: "!!!", want: language.English},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			var got language.Tag
+			h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = LanguageFromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Language", tt.accept)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("language = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHelloHandlerGreetsInRequestLanguage(t *testing.T) {
+	mw, err := NewAcceptLanguageMiddleware(&Config{Language: LanguageConfig{Default: "en", Supported: []string{"fr"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(NewHelloHandler(zap.NewNop(), testRenderer(t)))
+
+	req := httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader("Alice"))
+	req.Header.Set("Accept-Language", "fr")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Body.String(); got != "Bonjour, Alice\n" {
+		t.Errorf("body = %q, want %q", got, "Bonjour, Alice\n")
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Language" {
+		t.Errorf("Vary = %q, want Accept-Language", got)
+	}
+}
+
+func TestParseLanguagesRejectsInvalidTags(t *testing.T) {
+	for _, cfg := range []LanguageConfig{{Default: "not a tag"}, {Default: "en", Supported: []string{"???"}}} {
+		if _, err := parseLanguages(cfg); err == nil {
+			t.Errorf("parseLanguages(%+v) error = nil, want an error", cfg)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// latencyBounds 是延迟直方图各个桶的上界：从 100µs 到 100s，每个桶比前一个大 20%，
+// 所以百分位数的误差不超过 20%。超过最后一个上界的请求计入溢出桶。
+var latencyBounds = func() []time.Duration {
+	var bounds []time.Duration
+	for b := float64(100 * time.Microsecond); b < float64(100*time.Second); b *= 1.2 {
+		bounds = append(bounds, time.Duration(b))
+	}
+	return bounds
+}()
+
+// latencyHistogram 记录一段时间内的请求延迟，大小是固定的，与请求数无关。
+type latencyHistogram struct {
+	counts []uint64
+	total  uint64
+	max    time.Duration
+}
+
+func newLatencyHistogram() latencyHistogram {
+	return latencyHistogram{counts: make([]uint64, len(latencyBounds)+1)}
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	h.counts[sort.Search(len(latencyBounds), func(i int) bool { return latencyBounds[i] >= d })]++
+	h.total++
+	h.max = max(h.max, d)
+}
+
+// percentile 返回第 q（0 到 1 之间）分位数所在的桶的上界，不超过记录到的最大值。
+func (h *latencyHistogram) percentile(q float64) time.Duration {
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank && n > 0 {
+			if i == len(latencyBounds) {
+				return h.max
+			}
+			return min(latencyBounds[i], h.max)
+		}
+	}
+	return h.max
+}
+
+// LatencyReporter 汇总所有路由的请求延迟，每隔 LatencyConfig.Interval 输出一行带有 p50、p95、p99 和最大值的日志，
+// 然后重新开始统计，这样不必从每个请求的访问日志中计算延迟的分布。没有请求的时间段不输出。
+// 延迟由 DecorateRoutesWithMetrics 和 DecorateVHostRoutesWithMetrics 包装的路由记录，覆盖主路由器、管理路由器和虚拟主机的路由器；
+// 不包括 404 等没有匹配路由的请求，也不包括路由之外的中间件的耗时。
+type LatencyReporter struct {
+	log      *zap.Logger
+	interval time.Duration
+
+	mu   sync.Mutex
+	hist latencyHistogram
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewLatencyReporter(lc fx.Lifecycle, log *zap.Logger, cfg *Config) *LatencyReporter {
+	lr := &LatencyReporter{
+		log:      log,
+		interval: cfg.Latency.Interval,
+		hist:     newLatencyHistogram(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if lr.interval <= 0 {
+		return lr
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go lr.run()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(lr.stop)
+			select {
+			case <-lr.done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+	return lr
+}
+
+// Record 记录一个请求的延迟。没有开启汇总时什么也不做。
+func (lr *LatencyReporter) Record(d time.Duration) {
+	if lr.interval <= 0 {
+		return
+	}
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.hist.record(d)
+}
+
+func (lr *LatencyReporter) run() {
+	defer close(lr.done)
+	ticker := time.NewTicker(lr.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lr.stop:
+			return
+		case <-ticker.C:
+			lr.report()
+		}
+	}
+}
+
+// report 输出当前时间段的汇总并清空直方图。
+func (lr *LatencyReporter) report() {
+	lr.mu.Lock()
+	hist := lr.hist
+	lr.hist = newLatencyHistogram()
+	lr.mu.Unlock()
+
+	if hist.total == 0 {
+		return
+	}
+	lr.log.Info("Request latency summary",
+		zap.Duration("interval", lr.interval),
+		zap.Uint64("requests", hist.total),
+		zap.Duration("p50", hist.percentile(0.50)),
+		zap.Duration("p95", hist.percentile(0.95)),
+		zap.Duration("p99", hist.percentile(0.99)),
+		zap.Duration("max", hist.max),
+	)
+}
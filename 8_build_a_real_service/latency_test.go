@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Inasayang/fxdemo/8_build_a_real_service/internal/logtest"
+	"go.uber.org/fx/fxtest"
+)
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	repeat := func(d time.Duration, n int) []time.Duration {
+		out := make([]time.Duration, n)
+		for i := range out {
+			out[i] = d
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		record []time.Duration
+		q      float64
+		want   time.Duration
+	}{
+		{name: "empty", record: nil, q: 0.5, want: 0},
+		{name: "single value is capped at max", record: []time.Duration{time.Millisecond}, q: 0.99, want: time.Millisecond},
+		{name: "below first bound", record: []time.Duration{10 * time.Microsecond}, q: 0.5, want: 10 * time.Microsecond},
+		{name: "overflow bucket returns max", record: []time.Duration{time.Hour}, q: 0.5, want: time.Hour},
+		{
+			name:   "p50 within bucket error",
+			record: append(repeat(time.Millisecond, 90), repeat(time.Second, 10)...),
+			q:      0.50,
+			want:   bucketBound(time.Millisecond),
+		},
+		{
+			name:   "p95 in the slow tail",
+			record: append(repeat(time.Millisecond, 90), repeat(time.Second, 10)...),
+			q:      0.95,
+			want:   time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newLatencyHistogram()
+			for _, d := range tt.record {
+				h.record(d)
+			}
+			got := h.percentile(tt.q)
+			if got != tt.want {
+				t.Errorf("percentile(%v) = %v, want %v", tt.q, got, tt.want)
+			}
+			if len(tt.record) > 0 && (got < tt.want || float64(got) > 1.2*float64(tt.want)) {
+				t.Errorf("percentile(%v) = %v, more than 20%% above %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+// bucketBound 返回 d 所在的桶的上界。
+func bucketBound(d time.Duration) time.Duration {
+	for _, b := range latencyBounds {
+		if b >= d {
+			return b
+		}
+	}
+	return d
+}
+
+func TestLatencyReporterReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		record   []time.Duration
+		want     int
+	}{
+		{name: "empty interval", interval: time.Hour, record: nil, want: 0},
+		{name: "requests", interval: time.Hour, record: []time.Duration{time.Millisecond, 2 * time.Millisecond}, want: 1},
+		{name: "disabled", interval: 0, record: []time.Duration{time.Millisecond}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, logs := logtest.NewObservedLogger()
+			cfg := testConfig(t)
+			cfg.Latency.Interval = tt.interval
+			lr := NewLatencyReporter(fxtest.NewLifecycle(t), log, cfg)
+			for _, d := range tt.record {
+				lr.Record(d)
+			}
+			lr.report()
+			// 第二次汇总的时间段里没有请求，不应该输出。
+			lr.report()
+
+			entries := logs.FilterMessage("Request latency summary").All()
+			if len(entries) != tt.want {
+				t.Fatalf("logged %d summaries, want %d", len(entries), tt.want)
+			}
+			if tt.want == 0 {
+				return
+			}
+			fields := entries[0].ContextMap()
+			if got := fields["requests"]; got != uint64(len(tt.record)) {
+				t.Errorf("requests = %v, want %d", got, len(tt.record))
+			}
+			if got := fields["max"]; got != 2*time.Millisecond {
+				t.Errorf("max = %v, want %v", got, 2*time.Millisecond)
+			}
+		})
+	}
+}
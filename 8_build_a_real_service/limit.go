@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ConcurrencyLimitedRoute 是一个可选接口。实现了它的 Route 同时最多处理 MaxConcurrency 个请求，
+// 超出的请求立即得到 503。它与 ServerConfig.MaxConnections 这样的全局限制相互独立，
+// 适用于比其他接口昂贵得多的处理程序。MaxConcurrency 返回 0 表示不限制。
+type ConcurrencyLimitedRoute interface {
+	Route
+	MaxConcurrency() int
+}
+
+// QueuedRoute 是 ConcurrencyLimitedRoute 的扩展。名额用完时，最多 MaxQueue 个请求排队等待空出的名额，
+// 每个请求最多等待 QueueTimeout，超时后才得到 503；队列已满的请求仍然立即得到 503。
+type QueuedRoute interface {
+	ConcurrencyLimitedRoute
+	MaxQueue() int
+	QueueTimeout() time.Duration
+}
+
+// concurrencyLimit 返回一个用信号量限制并发数的中间件，n 为 0 时不做限制。
+func concurrencyLimit(n int, renderer *ErrorRenderer) Middleware {
+	return func(next http.Handler) http.Handler {
+		if n <= 0 {
+			return next
+		}
+		sem := make(chan struct{}, n)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				next.ServeHTTP(w, r)
+			default:
+				w.Header().Set("Retry-After", "1")
+				renderer.Render(w, r, http.StatusServiceUnavailable, "too many concurrent requests")
+			}
+		})
+	}
+}
+
+// concurrencyQueue 和 concurrencyLimit 类似，但名额用完时最多让 maxQueue 个请求排队，每个请求最多等待 wait。
+// 客户端在等待期间断开时直接返回，不再占用名额。
+func concurrencyQueue(n, maxQueue int, wait time.Duration, renderer *ErrorRenderer) Middleware {
+	return func(next http.Handler) http.Handler {
+		if n <= 0 {
+			return next
+		}
+		sem := make(chan struct{}, n)
+		var queued atomic.Int64
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case sem <- struct{}{}:
+			default:
+				if queued.Add(1) > int64(maxQueue) {
+					queued.Add(-1)
+					w.Header().Set("Retry-After", "1")
+					renderer.Render(w, r, http.StatusServiceUnavailable, "too many concurrent requests")
+					return
+				}
+				timer := time.NewTimer(wait)
+				select {
+				case sem <- struct{}{}:
+					timer.Stop()
+					queued.Add(-1)
+				case <-timer.C:
+					queued.Add(-1)
+					w.Header().Set("Retry-After", "1")
+					renderer.Render(w, r, http.StatusServiceUnavailable, "timed out waiting for a free slot")
+					return
+				case <-r.Context().Done():
+					timer.Stop()
+					queued.Add(-1)
+					return
+				}
+			}
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
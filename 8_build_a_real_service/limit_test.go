@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// blockingRoute 保留被包装的路由声明的可选接口，但 ServeHTTP 一直阻塞到 release 被关闭，
+// 测试用它占住路由的并发名额。
+type blockingRoute struct {
+	Route
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingRoute(route Route) *blockingRoute {
+	return &blockingRoute{Route: route, entered: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (r *blockingRoute) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.entered <- struct{}{}
+	<-r.release
+}
+
+func (r *blockingRoute) Unwrap() Route {
+	return r.Route
+}
+
+// serveAsync 在新的 goroutine 中处理请求，返回的通道在处理完成后收到状态码。
+func serveAsync(h http.Handler, r *http.Request) <-chan int {
+	done := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		done <- rec.Code
+	}()
+	return done
+}
+
+// build 按 GCHandler 声明的 MaxConcurrency 限制 /debug/gc 的并发数。
+func TestBuildConcurrencyLimitedRoute(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra int
+		want  int
+	}{
+		{name: "within limit", extra: 0},
+		{name: "over limit", extra: 1, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := newBlockingRoute(NewGCHandler(zap.NewNop()))
+			p := testRouterParams(t, testConfig(t), route)
+			mux, err := p.build("main", p.Routes)
+			if err != nil {
+				t.Fatalf("build() error = %v", err)
+			}
+
+			first := serveAsync(mux, httptest.NewRequest(http.MethodPost, "/debug/gc", nil))
+			<-route.entered
+			for range tt.extra {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/gc", nil))
+				if rec.Code != tt.want {
+					t.Errorf("concurrent request status = %d, want %d", rec.Code, tt.want)
+				}
+			}
+			close(route.release)
+			if code := <-first; code != http.StatusOK {
+				t.Errorf("first request status = %d, want %d", code, http.StatusOK)
+			}
+		})
+	}
+}
+
+// build 按 UploadHandler 声明的 QueuedRoute 参数排队：名额用完后，请求等到名额空出再处理，队列满了才得到 503。
+func TestBuildQueuedRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		queued int
+		want   int
+	}{
+		{name: "waits for a free slot", queued: 1, want: http.StatusOK},
+		{name: "queue full", queued: 9, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			upload := NewUploadHandler(zap.NewNop(), cfg, testRenderer(t))
+			route := newBlockingRoute(upload)
+			p := testRouterParams(t, cfg, route)
+			mux, err := p.build("main", p.Routes)
+			if err != nil {
+				t.Fatalf("build() error = %v", err)
+			}
+			request := func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/upload", nil)
+			}
+
+			var running []<-chan int
+			for range upload.MaxConcurrency() {
+				running = append(running, serveAsync(mux, request()))
+				<-route.entered
+			}
+			queued := make([]<-chan int, tt.queued)
+			for i := range queued {
+				queued[i] = serveAsync(mux, request())
+			}
+
+			switch tt.want {
+			case http.StatusOK:
+				// 排队的请求还没有被处理，释放名额后它才进入路由。
+				select {
+				case <-route.entered:
+					t.Fatal("queued request entered the route before a slot was free")
+				case <-time.After(20 * time.Millisecond):
+				}
+				close(route.release)
+				for i, done := range queued {
+					if code := <-done; code != http.StatusOK {
+						t.Errorf("queued request %d status = %d, want %d", i, code, http.StatusOK)
+					}
+				}
+			case http.StatusServiceUnavailable:
+				// 超出 MaxQueue 的那个请求立即得到 503，不必等 QueueTimeout。
+				select {
+				case code := <-waitAny(queued):
+					if code != tt.want {
+						t.Errorf("rejected request status = %d, want %d", code, tt.want)
+					}
+				case <-time.After(upload.QueueTimeout() / 2):
+					t.Fatal("no request was rejected before the queue timeout")
+				}
+				close(route.release)
+			}
+			for _, done := range running {
+				<-done
+			}
+		})
+	}
+}
+
+// waitAny 返回一个通道，它收到 channels 中最先完成的请求的状态码。
+func waitAny(channels []<-chan int) <-chan int {
+	first := make(chan int, len(channels))
+	for _, ch := range channels {
+		go func() {
+			first <- <-ch
+		}()
+	}
+	return first
+}
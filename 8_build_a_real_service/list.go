@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// 每页条目数的默认值和上限。
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Item 是 /items 返回的条目。
+type Item struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// ListHandler 在 /items 分页返回一个内存中的数据集，演示基于游标的分页。
+// limit 是每页的条目数；cursor 是上一页返回的 next_cursor，对客户端来说它是不透明的。
+// 游标记录的是上一页最后一个条目的 ID 而不是偏移量，所以翻页期间插入或删除条目时不会重复或漏掉条目。
+type ListHandler struct {
+	handler http.Handler
+	items   []Item
+}
+
+func NewListHandler(log *zap.Logger, renderer *ErrorRenderer) *ListHandler {
+	items := make([]Item, 0, 250)
+	for i := 1; i <= cap(items); i++ {
+		items = append(items, Item{ID: i, Name: fmt.Sprintf("item-%03d", i)})
+	}
+	h := &ListHandler{items: items}
+	h.handler = HandleErrors(log, renderer, h.serve)
+	return h
+}
+
+func (*ListHandler) Pattern() string {
+	return "/items"
+}
+
+func (*ListHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// 路由统计使用稳定的名字，以后路径改为 /v1/items 之类时，指标不会断开。
+func (*ListHandler) MetricName() string {
+	return "list_items"
+}
+
+// 列表的内容在进程的生命周期内不变，可以缓存。
+func (*ListHandler) Cacheable() bool {
+	return true
+}
+
+func (h *ListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+type itemPage struct {
+	Items      []Item `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func (h *ListHandler) serve(w http.ResponseWriter, r *http.Request) *HTTPError {
+	q := r.URL.Query()
+	limit := defaultPageSize
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			return &HTTPError{
+				Status:  http.StatusBadRequest,
+				Code:    "invalid_limit",
+				Message: fmt.Sprintf("limit must be an integer between 1 and %d", maxPageSize),
+				Err:     err,
+			}
+		}
+		limit = n
+	}
+	after := 0
+	if s := q.Get("cursor"); s != "" {
+		id, err := decodeCursor(s)
+		if err != nil {
+			return &HTTPError{
+				Status:  http.StatusBadRequest,
+				Code:    "invalid_cursor",
+				Message: "Malformed cursor",
+				Err:     err,
+			}
+		}
+		after = id
+	}
+
+	// items 按 ID 升序排列。
+	start := sort.Search(len(h.items), func(i int) bool { return h.items[i].ID > after })
+	end := min(start+limit, len(h.items))
+	page := itemPage{Items: h.items[start:end]}
+	if end < len(h.items) {
+		page.NextCursor = encodeCursor(h.items[end-1].ID)
+	}
+
+	if err := WriteJSON(w, http.StatusOK, page); err != nil {
+		return &HTTPError{
+			Status:  http.StatusInternalServerError,
+			Code:    "write_failed",
+			Message: "Failed to write response",
+			Err:     err,
+		}
+	}
+	return nil
+}
+
+// encodeCursor 把条目 ID 编码成 URL 安全的不透明字符串。
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("id:" + strconv.Itoa(id)))
+}
+
+func decodeCursor(s string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	if _, err := fmt.Sscanf(string(b), "id:%d", &id); err != nil || id < 0 || encodeCursor(id) != s {
+		return 0, fmt.Errorf("invalid cursor %q", s)
+	}
+	return id, nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
+
+func setBacklog(ln net.Listener, backlog int) error {
+	return errors.New("setting the listen backlog is not supported on this platform")
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortControl 是 net.ListenConfig.Control，在绑定之前为套接字打开 SO_REUSEPORT。
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// setBacklog 修改监听队列的长度。net 包总是使用系统的 somaxconn 调用 listen(2)，
+// 而对已经处于监听状态的套接字再次调用 listen(2) 会更新队列长度，内核仍会把它限制在 somaxconn 以内。
+func setBacklog(ln net.Listener, backlog int) error {
+	sc, ok := ln.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	err = raw.Control(func(fd uintptr) {
+		listenErr = unix.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return listenErr
+}
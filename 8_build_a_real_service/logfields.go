@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// logFields 由 LoggingMiddleware 放进 context，收集 AddLogField 添加的字段，请求结束后写进访问日志。
+// http.TimeoutHandler 在另一个 goroutine 中运行处理程序，所以需要加锁。
+type logFields struct {
+	mu     sync.Mutex
+	fields []zap.Field
+}
+
+type logFieldsKey struct{}
+
+// AddLogField 给当前请求的访问日志添加一个字段，处理程序和中间件用它把请求的元数据（缓存是否命中、
+// 查询了多少行等）集中到一行访问日志中，而不是各自输出一行日志。同一个 key 添加多次时保留最后一次的值。
+// key 不应与访问日志自带的字段（method、status 等）重名。不在请求中，或者在 LoggingMiddleware 之外调用时什么也不做。
+func AddLogField(ctx context.Context, key string, value any) {
+	lf, ok := ctx.Value(logFieldsKey{}).(*logFields)
+	if !ok {
+		return
+	}
+	field := zap.Any(key, value)
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	for i, f := range lf.fields {
+		if f.Key == key {
+			lf.fields[i] = field
+			return
+		}
+	}
+	lf.fields = append(lf.fields, field)
+}
+
+// snapshot 返回已添加的字段。
+func (lf *logFields) snapshot() []zap.Field {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return append([]zap.Field(nil), lf.fields...)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLogger 按 LogConfig 构建 zap.Logger，取代之前教程中使用的 zap.NewExample。
+// 时间戳统一使用 ISO8601 格式，Encoding 留空时使用 json。
+func NewLogger(cfg *Config) (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	zc := zap.NewProductionConfig()
+	zc.Level = zap.NewAtomicLevelAt(level)
+	// 不使用 zap 自带的采样，保证每一条日志都被输出。
+	zc.Sampling = nil
+	// Fx 的事件日志自带 "caller" 字段，关闭 zap 的调用位置以免重名。
+	zc.DisableCaller = true
+	zc.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	zc.EncoderConfig.EncodeDuration = zapcore.StringDurationEncoder
+
+	switch cfg.Log.Encoding {
+	case "", "json":
+		zc.Encoding = "json"
+	case "console":
+		zc.Encoding = "console"
+		zc.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	default:
+		return nil, fmt.Errorf("unknown log encoding %q", cfg.Log.Encoding)
+	}
+	return zc.Build()
+}
+
+// syncOnStop 注册刷新日志记录器的 OnStop 钩子。OnStop 钩子按注册的相反顺序执行，
+// 它由 appOptions 的第一个 fx.Invoke 注册（*zap.Logger 及其依赖都不注册钩子），所以在其他 OnStop 钩子之后执行，
+// 它们在停止时输出的日志都会被刷新。
+func syncOnStop(lc fx.Lifecycle, log *zap.Logger) {
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			// 输出到终端时 Sync 会返回 EINVAL 或 ENOTTY，这不是错误。
+			if err := log.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTTY) {
+				return fmt.Errorf("sync logger: %w", err)
+			}
+			return nil
+		},
+	})
+}
+
+// replaceGlobals 把 zap.L() 替换成 log，LoggerFromContext 在请求之外回退到它，而不是 zap 默认的空日志记录器。
+// 应用程序停止时恢复原来的全局日志记录器。它与 syncOnStop 在同一个 Invoke 中注册，所以恢复发生在其他 OnStop 钩子之后。
+func replaceGlobals(lc fx.Lifecycle, log *zap.Logger) {
+	undo := zap.ReplaceGlobals(log)
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			undo()
+			return nil
+		},
+	})
+}
+
+// DurationLogger 是 Fx 使用的日志记录器。它把事件原样交给 fxevent.ZapLogger，
+// 同时记下每个 OnStart/OnStop 钩子的耗时，在应用程序启动完成和停止完成时各输出一条汇总日志。
+type DurationLogger struct {
+	*fxevent.ZapLogger
+
+	mu    sync.Mutex
+	hooks []hookRuntime
+}
+
+func NewDurationLogger(log *zap.Logger) *DurationLogger {
+	return &DurationLogger{ZapLogger: &fxevent.ZapLogger{Logger: log}}
+}
+
+type hookRuntime struct {
+	caller  string
+	callee  string
+	runtime time.Duration
+}
+
+func (h hookRuntime) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("caller", h.caller)
+	enc.AddString("callee", h.callee)
+	enc.AddDuration("runtime", h.runtime)
+	return nil
+}
+
+type hookRuntimes []hookRuntime
+
+func (hs hookRuntimes) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, h := range hs {
+		if err := enc.AppendObject(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *DurationLogger) LogEvent(event fxevent.Event) {
+	l.ZapLogger.LogEvent(event)
+
+	switch e := event.(type) {
+	case *fxevent.OnStartExecuted:
+		l.record(e.CallerName, e.FunctionName, e.Runtime)
+	case *fxevent.OnStopExecuted:
+		l.record(e.CallerName, e.FunctionName, e.Runtime)
+	case *fxevent.Started:
+		l.summarize("OnStart hooks finished")
+	case *fxevent.Stopped:
+		l.summarize("OnStop hooks finished")
+	}
+}
+
+func (l *DurationLogger) record(caller, callee string, runtime time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hookRuntime{caller: caller, callee: callee, runtime: runtime})
+}
+
+// summarize 输出已记录钩子的汇总并清空记录，这样启动和停止各自独立统计。
+func (l *DurationLogger) summarize(msg string) {
+	l.mu.Lock()
+	hooks := l.hooks
+	l.hooks = nil
+	l.mu.Unlock()
+
+	var total time.Duration
+	var slowest hookRuntime
+	for _, h := range hooks {
+		total += h.runtime
+		if h.runtime > slowest.runtime {
+			slowest = h
+		}
+	}
+	l.Logger.Info(msg,
+		zap.Int("hooks", len(hooks)),
+		zap.Duration("total", total),
+		zap.String("slowest", slowest.callee),
+		// WithHookTimeout 包装过的钩子的 callee 都相同，caller 才能区分它们。
+		zap.String("slowest_caller", slowest.caller),
+		zap.Duration("slowest_runtime", slowest.runtime),
+		zap.Array("runtimes", hookRuntimes(hooks)),
+	)
+}
+
+// SwappableLogger 是交给 fx.WithLogger 的日志记录器。它不依赖任何类型，从 fx.New 一开始就可用：
+// 在 *zap.Logger 构建出来之前，事件由一个使用默认配置的引导日志记录器输出，
+// 这样 NewConfig、NewLogger 本身失败时错误仍然是可读的 JSON，而不是 Fx 默认的 stderr 格式。
+// 真正的日志记录器构建出来之后，用 Swap 替换它。
+type SwappableLogger struct {
+	mu      sync.RWMutex
+	current fxevent.Logger
+}
+
+// NewBootstrapLogger 返回以引导日志记录器开始的 SwappableLogger。
+func NewBootstrapLogger() *SwappableLogger {
+	// 固定的配置不会出错。
+	log, err := NewLogger(&Config{Log: LogConfig{Level: "info", Encoding: "json"}})
+	if err != nil {
+		panic(err)
+	}
+	return &SwappableLogger{current: &fxevent.ZapLogger{Logger: log.With(zap.Bool("bootstrap", true))}}
+}
+
+// Swap 让之后的事件交给 next 处理。
+func (l *SwappableLogger) Swap(next fxevent.Logger) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current = next
+}
+
+func (l *SwappableLogger) LogEvent(event fxevent.Event) {
+	l.mu.RLock()
+	current := l.current
+	l.mu.RUnlock()
+	current.LogEvent(event)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type loggerKey struct{}
+
+// LoggerFromContext 返回 LoggingMiddleware 为当前请求创建的子日志记录器，它的每一行日志都带有 request_id。
+// 不在请求中时返回 zap.L()，replaceGlobals 把它替换成了应用程序注入的日志记录器。
+func LoggerFromContext(ctx context.Context) *zap.Logger {
+	return loggerFrom(ctx, zap.L())
+}
+
+// loggerFrom 与 LoggerFromContext 相同，但在没有请求日志记录器时使用 fallback，处理程序用它回退到自己的日志记录器。
+func loggerFrom(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if log, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return log
+	}
+	return fallback
+}
+
+// NewLoggingMiddleware 为每个请求创建带有 request_id 的子日志记录器并放进 context，
+// 请求结束后用它输出一行访问日志，这样访问日志和处理程序的日志可以通过 request_id 关联起来。
+// 请求经过认证时（见 WithPrincipal），访问日志还带有 principal；AddLogField 添加的字段也写在访问日志中。
+// 处理程序或更内层的中间件 panic 时，访问日志照样输出，状态码按 500 记录并带有 panicked 字段，panic 继续交给 RecoveryMiddleware。访问日志按 AccessLogConfig.Sampling 采样，5xx 的请求总会被记录。它必须位于 RequestIDMiddleware 之内。
+func NewLoggingMiddleware(log *zap.Logger, cfg *Config) Wrapper {
+	sampling := uint64(max(cfg.AccessLog.Sampling, 1))
+	var count atomic.Uint64
+	return Named("logging", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqLog := log.With(zap.String("request_id", RequestIDFromContext(r.Context())))
+			sw := newStatusWriter(w)
+			start := time.Now()
+			ctx := context.WithValue(r.Context(), loggerKey{}, reqLog)
+			ctx = context.WithValue(ctx, principalSlotKey{}, &principalSlot{})
+			extra := &logFields{}
+			ctx = context.WithValue(ctx, logFieldsKey{}, extra)
+			panicked := true
+			defer func() {
+				status := sw.Status()
+				if panicked && sw.status == 0 {
+					// RecoveryMiddleware 会返回 500。
+					status = http.StatusInternalServerError
+				}
+				if count.Add(1)%sampling != 0 && status < 500 {
+					return
+				}
+				fields := []zap.Field{
+					zap.String("method", r.Method),
+					zap.String("url", r.URL.String()),
+					zap.String("remote_addr", r.RemoteAddr),
+					zap.Int("status", status),
+					zap.Int64("bytes", sw.bytes),
+					zap.Duration("duration", time.Since(start)),
+				}
+				if panicked {
+					fields = append(fields, zap.Bool("panicked", true))
+				}
+				if principal := PrincipalFromContext(ctx); principal != "" {
+					fields = append(fields, zap.String("principal", principal))
+				}
+				fields = append(fields, extra.snapshot()...)
+				reqLog.Info("Request completed", fields...)
+			}()
+			next.ServeHTTP(sw, r.WithContext(ctx))
+			panicked = false
+		})
+	})
+}
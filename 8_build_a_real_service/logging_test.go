@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Inasayang/fxdemo/8_build_a_real_service/internal/logtest"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func TestLoggerFromContext(t *testing.T) {
+	global, globalLogs := logtest.NewObservedLogger()
+	reqLog, reqLogs := logtest.NewObservedLogger()
+
+	lc := fxtest.NewLifecycle(t)
+	replaceGlobals(lc, global)
+	lc.RequireStart()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		wantReq  int
+		wantGlob int
+	}{
+		{name: "request logger", ctx: context.WithValue(context.Background(), loggerKey{}, reqLog), wantReq: 1},
+		{name: "fallback to injected logger", ctx: context.Background(), wantGlob: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqBefore, globBefore := reqLogs.Len(), globalLogs.Len()
+			LoggerFromContext(tt.ctx).Info("message")
+			if got := reqLogs.Len() - reqBefore; got != tt.wantReq {
+				t.Errorf("request logger got %d entries, want %d", got, tt.wantReq)
+			}
+			if got := globalLogs.Len() - globBefore; got != tt.wantGlob {
+				t.Errorf("injected logger got %d entries, want %d", got, tt.wantGlob)
+			}
+		})
+	}
+
+	lc.RequireStop()
+	if zap.L() == global {
+		t.Error("zap.L() still returns the injected logger after stop")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogTail 在内存中保存最近的日志，供 /debug/logs 读取。它以 zapcore.Core 的形式与原有的输出并列（tee），
+// 只有 /debug/logs 可用时才会挂到日志记录器上。
+type LogTail struct {
+	enabled bool
+
+	mu      sync.Mutex
+	entries [][]byte
+	next    int
+	full    bool
+	subs    map[chan []byte]struct{}
+}
+
+// NewLogTail 按 DebugConfig 创建 LogTail。没有开启 DebugConfig.Enabled 或没有设置 DebugConfig.LogsToken 时，
+// 它不保存任何日志，/debug/logs 也返回 404。
+func NewLogTail(cfg *Config) *LogTail {
+	return &LogTail{
+		enabled: cfg.Debug.Enabled && cfg.Debug.LogsToken != "" && cfg.Debug.LogsBuffer > 0,
+		entries: make([][]byte, max(cfg.Debug.LogsBuffer, 0)),
+		subs:    make(map[chan []byte]struct{}),
+	}
+}
+
+// AttachLogTail 用于 fx.Decorate：它让 *zap.Logger 同时把日志写入 LogTail。
+func AttachLogTail(log *zap.Logger, tail *LogTail) *zap.Logger {
+	if !tail.enabled {
+		return log
+	}
+	return log.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(c, &logTailCore{LevelEnabler: c, enc: newLogTailEncoder(), tail: tail})
+	}))
+}
+
+func newLogTailEncoder() zapcore.Encoder {
+	ec := zap.NewProductionEncoderConfig()
+	ec.EncodeTime = zapcore.ISO8601TimeEncoder
+	ec.EncodeDuration = zapcore.StringDurationEncoder
+	// SSE 的一个事件以空行结束，日志本身不能带换行。
+	ec.LineEnding = ""
+	return zapcore.NewJSONEncoder(ec)
+}
+
+func (t *LogTail) append(line []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[t.next] = line
+	t.next = (t.next + 1) % len(t.entries)
+	if t.next == 0 {
+		t.full = true
+	}
+	for ch := range t.subs {
+		// 跟不上的订阅者丢掉这一条，不能阻塞写日志的 goroutine。
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// Subscribe 返回当前保存的日志（从旧到新）和之后新日志的通道。不再读取时必须调用 cancel。
+func (t *LogTail) Subscribe() (recent [][]byte, ch <-chan []byte, cancel func()) {
+	c := make(chan []byte, 64)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.full {
+		recent = append(recent, t.entries[t.next:]...)
+	}
+	recent = append(recent, t.entries[:t.next]...)
+	t.subs[c] = struct{}{}
+
+	return recent, c, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.subs, c)
+	}
+}
+
+// logTailCore 把日志编码成 JSON 后写入 LogTail。
+type logTailCore struct {
+	zapcore.LevelEnabler
+	enc  zapcore.Encoder
+	tail *LogTail
+}
+
+func (c *logTailCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &logTailCore{LevelEnabler: c.LevelEnabler, enc: enc, tail: c.tail}
+}
+
+func (c *logTailCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *logTailCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	line := []byte(buf.String())
+	buf.Free()
+	c.tail.append(line)
+	return nil
+}
+
+func (*logTailCore) Sync() error {
+	return nil
+}
+
+// LogsHandler 以 Server-Sent Events 的形式输出最近的日志，然后持续推送新的日志，直到客户端断开或服务器关闭。
+// 它要求 Authorization: Bearer <DebugConfig.LogsToken>，LogTail 不可用时返回 404。认证成功的请求以 logsPrincipal 记录。
+type LogsHandler struct {
+	log      *zap.Logger
+	tail     *LogTail
+	token    string
+	streams  *StreamRegistry
+	renderer *ErrorRenderer
+}
+
+// logsPrincipal 是持有 DebugConfig.LogsToken 的调用方的 principal，见 WithPrincipal。
+const logsPrincipal = "debug-logs"
+
+func NewLogsHandler(log *zap.Logger, cfg *Config, tail *LogTail, streams *StreamRegistry, renderer *ErrorRenderer) *LogsHandler {
+	return &LogsHandler{log: log, tail: tail, token: cfg.Debug.LogsToken, streams: streams, renderer: renderer}
+}
+
+func (*LogsHandler) Pattern() string {
+	return "/debug/logs"
+}
+
+// 和 /stream 一样，事件流不能被 http.TimeoutHandler 缓冲。
+func (*LogsHandler) Timeout() time.Duration {
+	return 0
+}
+
+func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.tail.enabled {
+		h.renderer.Render(w, r, http.StatusNotFound, "")
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="debug"`)
+		h.renderer.Render(w, r, http.StatusUnauthorized, "")
+		return
+	}
+	r = WithPrincipal(r, logsPrincipal)
+
+	ctx, release := h.streams.Track(r.Context())
+	defer release()
+	log := loggerFrom(ctx, h.log)
+	recent, entries, cancel := h.tail.Subscribe()
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	// 和 /stream 一样，事件流不受 ServerConfig.WriteTimeout 限制。
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn("Failed to clear write deadline", zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	write := func(line []byte) bool {
+		if _, err := w.Write([]byte("data: " + string(line) + "\n\n")); err != nil {
+			log.Warn("Failed to write log stream", zap.Error(err))
+			return false
+		}
+		return true
+	}
+	for _, line := range recent {
+		if !write(line) {
+			return
+		}
+	}
+	for {
+		if err := rc.Flush(); err != nil {
+			log.Warn("Failed to flush log stream", zap.Error(err))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case line := <-entries:
+			if !write(line) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Inasayang/fxdemo/8_build_a_real_service/internal/logtest"
+	"go.uber.org/zap"
+)
+
+// 认证成功的 /debug/logs 请求，访问日志带有 logsPrincipal。
+func TestLogsHandlerPrincipal(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantPrincipal string
+	}{
+		{name: "no token", authorization: "", wantStatus: http.StatusUnauthorized, wantPrincipal: ""},
+		{name: "wrong token", authorization: "Bearer nope", wantStatus: http.StatusUnauthorized, wantPrincipal: ""},
+		{name: "valid token", authorization: "Bearer secret", wantStatus: http.StatusOK, wantPrincipal: logsPrincipal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Debug.Enabled = true
+			cfg.Debug.LogsToken = "secret"
+			log, logs := logtest.NewObservedLogger()
+			h := NewLoggingMiddleware(log, cfg).Wrap(
+				NewLogsHandler(zap.NewNop(), cfg, NewLogTail(cfg), NewStreamRegistry(), testRenderer(t)),
+			)
+
+			// context 已经取消，输出保存的日志后事件流立即结束。
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			r := httptest.NewRequestWithContext(ctx, http.MethodGet, "/debug/logs", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			entries := logs.FilterMessage("Request completed").All()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d access log lines, want 1", len(entries))
+			}
+			got, _ := entries[0].ContextMap()["principal"].(string)
+			if got != tt.wantPrincipal {
+				t.Errorf("principal = %q, want %q", got, tt.wantPrincipal)
+			}
+		})
+	}
+}
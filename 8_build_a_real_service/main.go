@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Inasayang/fxdemo/8_build_a_real_service/fxrun"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"go.uber.org/zap"
+)
+
+// 从这一步开始，应用程序按职责拆分成多个文件，main.go 只负责把它们组装起来。
+// 应用程序由 fxrun.RunBlocking 运行，SIGINT 或 SIGTERM 取消它的 context；启动或停止失败时以非零退出码退出。
+func main() {
+	runFor := flag.Duration("run-for", 0, "stop the application after this duration (0 runs until a signal)")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := fx.Options(appOptions(), fxrun.WithParentContext(ctx))
+	if *runFor > 0 {
+		opts = fx.Options(opts, fxrun.RunFor(*runFor))
+	}
+	if err := CheckProviders(opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := fxrun.RunBlocking(ctx, fx.New(opts)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code := 1
+		if exitErr := (*fxrun.ExitCodeError)(nil); errors.As(err, &exitErr) {
+			code = exitErr.Code
+		}
+		stop()
+		os.Exit(code)
+	}
+}
+
+// appOptions 返回组成应用程序的全部选项，main 先用 CheckProviders 校验它们再运行。
+func appOptions() fx.Option {
+	boot := NewBootstrapLogger()
+	return fx.Options(
+		fx.WithLogger(func() fxevent.Logger { return boot }),
+		// 一旦 *zap.Logger 构建成功，就换成 DurationLogger：它在 ZapLogger 的基础上，额外汇总每个生命周期钩子的耗时。
+		// 这个 InvokeStep 必须是第一个，这样 OnStart/OnStop 的事件都由它记录，syncOnStop 注册的钩子也会最后执行。
+		InvokeStep("logger", func(lc fx.Lifecycle, log *zap.Logger) {
+			boot.Swap(NewDurationLogger(log))
+			syncOnStop(lc, log)
+			replaceGlobals(lc, log)
+		}),
+		ConfigModule(),
+		httpModule(),
+		// 中间件按优先级从外到内排列，数字之间留出空隙，方便以后插入新的中间件。
+		// NewChain 总是把 recovery 放在最外层，见 NewChain。
+		AsMiddleware(NewRecoveryMiddleware, 50),
+		AsMiddleware((*DrainTracker).Middleware, 100),
+		AsMiddleware(NewRequestIDMiddleware, 200),
+		AsMiddleware(NewRequestCacheMiddleware, 300),
+		AsMiddleware(NewLoggingMiddleware, 400),
+		AsMiddleware(NewHostValidationMiddleware, 420),
+		AsMiddleware(NewHTTPSRedirectMiddleware, 450),
+		AsMiddleware(NewWarmupGateMiddleware, 460),
+		AsMiddleware(NewRateLimitMiddleware, 470),
+		AsMiddleware(NewServerTimingMiddleware, 700),
+		AsMiddleware(NewTrailingSlashMiddleware, 800),
+		AsMiddleware(NewHeadMiddleware, 900),
+		AsMiddleware(NewQueryGuardMiddleware, 1000),
+		AsMiddleware(NewBodyLimitMiddleware, 1100),
+		AsMiddleware(NewDecompressionMiddleware, 1150),
+		AsMiddleware(NewAcceptLanguageMiddleware, 1200),
+		AsMiddleware(NewResponseEnvelopeMiddleware, 1250),
+		AsMiddleware(NewCompressionMiddleware, 1300),
+		fx.Provide(
+			NewErrorRenderer,
+			NewDrainTracker,
+			AsRoute(NewEchoHandler),
+			AsRoute(NewEchoFormHandler),
+			AsRoute(NewUploadHandler),
+			AsRoute(NewListHandler),
+			AsRoute(NewHelloHandler),
+			AsRouteIf(debugEnabled, NewStatsHandler),
+			AsRouteIf(debugEnabled, NewMetricsHandler),
+			AsRouteIf(debugEnabled, NewConfigHandler),
+			AsRouteIf(debugEnabled, NewSlowHandler),
+			AsRouteIf(debugEnabled, NewGCHandler),
+			AsRouteIf(debugEnabled, NewBuildInfoHandler),
+			AsRouteIf(debugEnabled, NewHeadersHandler),
+			AsRouteIf(docsEnabled, NewSwaggerHandler),
+			AsRoute(NewReadyzHandler),
+			AsRoute(NewHealthHandler),
+			AsRoute(NewDrainHandler),
+			AsRoute(NewUndrainHandler),
+			AsRoute(NewRateLimitHandler),
+			AsRoute(NewStreamHandler),
+			AsRouteIf(debugEnabled, NewLogsHandler),
+			AsRoute(NewFaviconHandler),
+			AsRoute(NewTimeHandler),
+			AsRouteIf(upstreamEnabled, NewUpstreamHandler),
+			AsRouteIf(debugEnabled, NewRoutesHandler),
+			NewIDGenerator,
+			NewRand,
+			NewErrGroup,
+			NewWorker,
+			NewMetricsReportTask,
+			NewStartTime,
+			NewRouteMetrics,
+			NewLatencyReporter,
+			NewSlowRequestLog,
+			NewReadinessProbe,
+			NewCacheWarmup,
+			NewDrainer,
+			NewRateLimiter,
+			NewStreamRegistry,
+			NewLogTail,
+			NewHTTPClient,
+			NewOutboundClient,
+			newShutdownSignal,
+			NewStartupSignal,
+			NewShutdownContext,
+			NewRouterProvider,
+			NewRouteTable,
+			fx.Annotate(NewCodecs, fx.ParamTags(`group:"codecs"`)),
+			AsCodec(NewMsgPackCodec),
+			NewCacheMiddleware,
+			NewAdminMiddleware,
+			NewCSRFMiddleware,
+			NewLogger,
+		),
+		// "status" 路由组只有探针。把一个主机名（例如 status.example.com）映射到它，见 VHostConfig.Hosts，
+		// 这个主机名就只暴露探针，其他主机名仍然使用 "routes" 组。
+		AsVHostRoute("status", NewReadyzHandler),
+		AsVHostRoute("status", NewHealthHandler),
+		// 让 /debug/logs 能读到应用程序的日志，见 LogTail。
+		fx.Decorate(AttachLogTail),
+		InvokeStep("server", func(*http.Server, *Worker) {}),
+		InvokeStep("dependency graph", logDependencyGraph),
+		// 必须是最后一个 InvokeStep，见 cancelOnStop。
+		InvokeStep("shutdown", cancelOnStop),
+	)
+}
+
+// httpModule 把 "routes" 组的消费者（路由器、处理程序链和服务器）放进一个 fx.Module。
+// fx.Decorate 只作用于所在的模块及其子模块，而父模块的装饰器先于子模块执行，
+// 所以路由统计的装饰器放在模块内部，根模块仍然可以再装饰一次 "routes" 组，例如用 ReplaceRoutes 替换全部路由。
+func httpModule() fx.Option {
+	return fx.Module("http",
+		fx.Provide(
+			NewHTTPServer,
+			NewRouter,
+			NewAdminRouter,
+			fx.Annotate(
+				NewChain,
+				fx.ParamTags(``, `group:"middlewares"`, `group:"disabled_middlewares"`),
+			),
+			NewHandler,
+			NewAdminHandler,
+		),
+		// 用 fx.Decorate 为 "routes" 组和 "vhost_routes" 组里的每个路由加上统计。
+		fx.Decorate(
+			fx.Annotate(
+				DecorateRoutesWithMetrics,
+				fx.ParamTags(`group:"routes"`),
+				fx.ResultTags(`group:"routes"`),
+			),
+			fx.Annotate(
+				DecorateVHostRoutesWithMetrics,
+				fx.ParamTags(`group:"vhost_routes"`),
+				fx.ResultTags(`group:"vhost_routes"`),
+			),
+		),
+	)
+}
+
+// curl -X POST -d "你好，这是一个测试！" http://localhost:8080/echo
+// curl -X POST -d "你好，这是一个测试！" http://localhost:8080/hello
+// curl -F "file=@go.mod" http://localhost:8080/upload
+// 在浏览器中打开 http://localhost:8080/echo/form （表单受 CSRF 保护）
+// curl "http://localhost:8080/items?limit=5"
+// echo "你好" | gzip | curl --data-binary @- -H "Content-Encoding: gzip" http://localhost:8080/echo
+// curl -i http://localhost:8080/readyz/
+// curl -I http://localhost:8080/hello
+// curl -v -H "Expect: 100-continue" -H "Content-Length: 20000000" -X POST http://localhost:8080/echo
+// curl -H "Accept: text/html" http://localhost:8080/missing
+// /debug/ 下的接口都需要 DebugConfig.Enabled：
+// curl http://localhost:8080/debug/stats
+// curl http://localhost:8080/debug/metrics
+// curl http://localhost:8080/debug/config
+// curl http://localhost:8080/debug/slow
+// curl http://localhost:8080/debug/buildinfo
+// curl http://localhost:8080/debug/routes
+// curl -H "Authorization: Bearer secret" http://localhost:8080/debug/headers
+// curl -X POST http://localhost:8080/debug/gc
+// curl http://localhost:8080/docs （需要 DocsConfig.Enabled）
+// curl http://localhost:8080/readyz
+// curl http://localhost:8080/health
+// curl -X POST http://localhost:8080/admin/drain
+// curl -X POST http://localhost:8080/admin/undrain
+// curl -X PUT -d '{"rate": 5, "burst": 10}' http://localhost:8080/admin/ratelimit
+// curl -N http://localhost:8080/stream
+// curl "http://localhost:8080/time?tz=Asia/Shanghai"
+// curl -H "Accept: application/msgpack" http://localhost:8080/time | xxd
+// curl --raw "http://localhost:8080/stream?count=3" （--raw 显示分块编码和 trailer）
+// curl -N -H "Authorization: Bearer $TOKEN" http://localhost:8080/debug/logs （需要 DebugConfig.Enabled 和 DebugConfig.LogsToken）
+
+// go run ./8_build_a_real_service -run-for 10s
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MetricNamer 是一个可选接口。路由的 Pattern 可能包含通配符，直接作为指标标签会导致基数过高，
+// 实现了 MetricNamer 的路由会使用 MetricName 作为稳定的标签。
+type MetricNamer interface {
+	MetricName() string
+}
+
+// metricLabel 返回路由的指标标签，没有 MetricName 时回退到路由的第一个模式。
+func metricLabel(route Route) string {
+	if n, ok := routeAs[MetricNamer](route); ok {
+		if name := n.MetricName(); name != "" {
+			return name
+		}
+	}
+	return routePatterns(route)[0]
+}
+
+// RouteStats 是一个路由的累计统计。
+type RouteStats struct {
+	Requests      uint64        `json:"requests"`
+	ServerErrors  uint64        `json:"server_errors"`
+	TotalDuration time.Duration `json:"total_duration_ns"`
+
+	// 以下是 gzip 请求体的统计，见 NewDecompressionMiddleware。MaxDecompressionRatio 是解压后与解压前字节数之比的最大值。
+	CompressedRequests    uint64  `json:"compressed_requests,omitempty"`
+	CompressedBytes       uint64  `json:"compressed_bytes,omitempty"`
+	DecompressedBytes     uint64  `json:"decompressed_bytes,omitempty"`
+	MaxDecompressionRatio float64 `json:"max_decompression_ratio,omitempty"`
+
+	// Principals 按 principal 统计经过认证的请求数，见 WithPrincipal。
+	Principals map[string]uint64 `json:"principals,omitempty"`
+}
+
+// maxPrincipalsPerRoute 是每个路由单独统计的 principal 数量的上限，超过的 principal 计入 otherPrincipal，
+// 避免 principal 的基数意外过高时统计无限增长。
+const maxPrincipalsPerRoute = 100
+
+const otherPrincipal = "other"
+
+// RouteMetrics 按标签在内存中汇总每个路由的请求数、5xx 数和总耗时。
+type RouteMetrics struct {
+	mu     sync.Mutex
+	routes map[string]*RouteStats
+}
+
+func NewRouteMetrics() *RouteMetrics {
+	return &RouteMetrics{routes: make(map[string]*RouteStats)}
+}
+
+// Observe 记录一个请求，principal 为空表示请求没有经过认证。
+func (m *RouteMetrics) Observe(label, principal string, status int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.routes[label]
+	if !ok {
+		s = &RouteStats{}
+		m.routes[label] = s
+	}
+	s.Requests++
+	if status >= 500 {
+		s.ServerErrors++
+	}
+	s.TotalDuration += d
+	if principal != "" {
+		if s.Principals == nil {
+			s.Principals = make(map[string]uint64)
+		}
+		if _, ok := s.Principals[principal]; !ok && len(s.Principals) >= maxPrincipalsPerRoute {
+			principal = otherPrincipal
+		}
+		s.Principals[principal]++
+	}
+}
+
+// ObserveDecompression 记录一个 gzip 请求体压缩前后的字节数。
+func (m *RouteMetrics) ObserveDecompression(label string, compressed, decompressed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.routes[label]
+	if !ok {
+		s = &RouteStats{}
+		m.routes[label] = s
+	}
+	s.CompressedRequests++
+	s.CompressedBytes += uint64(compressed)
+	s.DecompressedBytes += uint64(decompressed)
+	if compressed > 0 {
+		s.MaxDecompressionRatio = max(s.MaxDecompressionRatio, float64(decompressed)/float64(compressed))
+	}
+}
+
+// Snapshot 返回当前统计的副本。
+func (m *RouteMetrics) Snapshot() map[string]RouteStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]RouteStats, len(m.routes))
+	for label, s := range m.routes {
+		c := *s
+		c.Principals = maps.Clone(s.Principals)
+		out[label] = c
+	}
+	return out
+}
+
+// metricsRoute 包装一个路由，记录它处理的每个请求。
+type metricsRoute struct {
+	Route
+	label   string
+	metrics *RouteMetrics
+	latency *LatencyReporter
+	slow    *SlowRequestLog
+}
+
+func (r *metricsRoute) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	sw := newStatusWriter(w)
+	start := time.Now()
+	r.Route.ServeHTTP(sw, req)
+	d := time.Since(start)
+	r.metrics.Observe(r.label, PrincipalFromContext(req.Context()), sw.Status(), d)
+	r.latency.Record(d)
+	r.slow.Observe(req, r.pattern(req), sw.Status(), start, d)
+}
+
+// pattern 返回处理请求的路由器匹配到的模式。Router 不是 http.ServeMux、没有设置 r.Pattern 时，回退到路由的第一个模式。
+func (r *metricsRoute) pattern(req *http.Request) string {
+	if req.Pattern != "" {
+		return req.Pattern
+	}
+	return routePatterns(r.Route)[0]
+}
+
+func (r *metricsRoute) Unwrap() Route {
+	return r.Route
+}
+
+// newMetricsRoute 用 metricsRoute 包装 route。
+func newMetricsRoute(route Route, metrics *RouteMetrics, latency *LatencyReporter, slow *SlowRequestLog) Route {
+	return &metricsRoute{
+		Route:   route,
+		label:   metricLabel(route),
+		metrics: metrics,
+		latency: latency,
+		slow:    slow,
+	}
+}
+
+// DecorateRoutesWithMetrics 是 "routes" 组的装饰器：它用 fx.Decorate 包装组内的每个路由，
+// 这样所有路由都会被统计，而不需要修改处理程序或 NewRouter。管理路由器的路由也来自 "routes" 组，同样会被统计。
+func DecorateRoutesWithMetrics(routes []Route, metrics *RouteMetrics, latency *LatencyReporter, slow *SlowRequestLog) []Route {
+	decorated := make([]Route, len(routes))
+	for i, route := range routes {
+		decorated[i] = newMetricsRoute(route, metrics, latency, slow)
+	}
+	return decorated
+}
+
+// DecorateVHostRoutesWithMetrics 是 "vhost_routes" 组的装饰器，和 DecorateRoutesWithMetrics 一样包装每个虚拟主机的路由。
+func DecorateVHostRoutesWithMetrics(routes []vhostRoute, metrics *RouteMetrics, latency *LatencyReporter, slow *SlowRequestLog) []vhostRoute {
+	decorated := make([]vhostRoute, len(routes))
+	for i, vr := range routes {
+		decorated[i] = vhostRoute{group: vr.group, route: newMetricsRoute(vr.route, metrics, latency, slow)}
+	}
+	return decorated
+}
+
+// MetricsHandler 以 JSON 格式返回路由的统计信息。
+type MetricsHandler struct {
+	log     *zap.Logger
+	metrics *RouteMetrics
+}
+
+func NewMetricsHandler(log *zap.Logger, metrics *RouteMetrics) *MetricsHandler {
+	return &MetricsHandler{log: log, metrics: metrics}
+}
+
+func (*MetricsHandler) Pattern() string {
+	return "/debug/metrics"
+}
+
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snapshot := h.metrics.Snapshot()
+	labels := make([]string, 0, len(snapshot))
+	for label := range snapshot {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	type entry struct {
+		Route string `json:"route"`
+		RouteStats
+	}
+	resp := make([]entry, 0, len(labels))
+	for _, label := range labels {
+		resp = append(resp, entry{Route: label, RouteStats: snapshot[label]})
+	}
+
+	if err := WriteJSON(w, http.StatusOK, resp); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func TestMetricLabel(t *testing.T) {
+	renderer := testRenderer(t)
+	tests := []struct {
+		name  string
+		route Route
+		want  string
+	}{
+		{name: "metric name", route: NewListHandler(zap.NewNop(), renderer), want: "list_items"},
+		{name: "pattern", route: NewTimeHandler(zap.NewNop(), NewCodecs(nil), renderer), want: "/time"},
+		{name: "decorated", route: &metricsRoute{Route: NewListHandler(zap.NewNop(), renderer)}, want: "list_items"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metricLabel(tt.route); got != tt.want {
+				t.Errorf("metricLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// DecorateRoutesWithMetrics 按 MetricName 统计经过 build 注册的路由。
+func TestDecorateRoutesWithMetrics(t *testing.T) {
+	cfg := testConfig(t)
+	renderer := testRenderer(t)
+	metrics := NewRouteMetrics()
+	routes := DecorateRoutesWithMetrics(
+		[]Route{NewListHandler(zap.NewNop(), renderer), NewTimeHandler(zap.NewNop(), NewCodecs(nil), renderer)},
+		metrics,
+		NewLatencyReporter(fxtest.NewLifecycle(t), zap.NewNop(), cfg),
+		NewSlowRequestLog(cfg, zap.NewNop()),
+	)
+	p := testRouterParams(t, cfg, routes...)
+	mux, err := p.build("main", p.Routes)
+	if err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+
+	// limit=0 是 400，失败的请求同样计入路由的统计。
+	for _, target := range []string{"/items?limit=1", "/items?limit=0", "/time"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	snapshot := metrics.Snapshot()
+	want := map[string]uint64{"list_items": 2, "/time": 1}
+	if len(snapshot) != len(want) {
+		t.Errorf("Snapshot() labels = %v, want %v", snapshot, want)
+	}
+	for label, n := range want {
+		if got := snapshot[label].Requests; got != n {
+			t.Errorf("Snapshot()[%q].Requests = %d, want %d", label, got, n)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Middleware 包装一个 http.Handler，在请求到达路由之前或之后做一些通用的处理。
+type Middleware func(http.Handler) http.Handler
+
+// Wrap 让 Middleware 满足 Wrapper。
+func (m Middleware) Wrap(h http.Handler) http.Handler {
+	return m(h)
+}
+
+// Wrapper 是 AsMiddleware 接受的中间件类型。除了普通的 Middleware，也可以是带名字的中间件，见 Named。
+type Wrapper interface {
+	Wrap(http.Handler) http.Handler
+}
+
+// NamedMiddleware 是可选接口：实现它的中间件在链中只会出现一次。
+type NamedMiddleware interface {
+	Name() string
+}
+
+// namedMiddleware 是 Named 返回的中间件。
+type namedMiddleware struct {
+	name string
+	Middleware
+}
+
+func (m namedMiddleware) Name() string {
+	return m.name
+}
+
+// Named 给中间件起一个名字。同一个名字的中间件被多次放入 "middlewares" 组时，NewChain 只保留最靠外的一个。
+func Named(name string, m Middleware) Wrapper {
+	return namedMiddleware{name: name, Middleware: m}
+}
+
+// middlewareEntry 是 "middlewares" 组中的元素：中间件和它的优先级。
+type middlewareEntry struct {
+	Wrapper
+	priority int
+}
+
+// AsMiddleware 注册一个中间件。f 返回 Middleware 或其他 Wrapper，也可以再返回一个 error。
+// NewChain 按 priority 从小到大排列中间件，priority 越小越靠外，相同时的顺序不做保证。
+// 每个中间件在自己的 fx.Module 中以 fx.Private 提供，所以多个中间件的 Wrapper 不会冲突，
+// 之后再和 priority 一起放入 "middlewares" 组。
+func AsMiddleware(f any, priority int) fx.Option {
+	return fx.Module("middleware",
+		fx.Provide(
+			fx.Annotate(f, fx.As(new(Wrapper))),
+			fx.Private,
+		),
+		fx.Provide(
+			fx.Annotate(
+				func(w Wrapper) middlewareEntry {
+					return middlewareEntry{Wrapper: w, priority: priority}
+				},
+				fx.ResultTags(`group:"middlewares"`),
+			),
+		),
+	)
+}
+
+// Chain 是按顺序排列的中间件，第一个位于最外层。
+type Chain []Middleware
+
+// WithoutMiddleware 从中间件链中去掉名为 name 的默认中间件，例如使用者有自己的访问日志时去掉内置的。
+// 和 fxrun.WithParentContext 一样，它与 appOptions() 一起传给 fx.New；被去掉的中间件的构造函数仍然会被调用。
+func WithoutMiddleware(name string) fx.Option {
+	return fx.Supply(fx.Annotated{Group: "disabled_middlewares", Target: name})
+}
+
+// WithoutLogging 去掉访问日志中间件，见 NewLoggingMiddleware。
+func WithoutLogging() fx.Option {
+	return WithoutMiddleware("logging")
+}
+
+// WithoutRecovery 去掉 panic 恢复中间件，见 NewRecoveryMiddleware。
+func WithoutRecovery() fx.Option {
+	return WithoutMiddleware("recovery")
+}
+
+// WithoutCompression 去掉响应压缩中间件，见 NewCompressionMiddleware。
+func WithoutCompression() fx.Option {
+	return WithoutMiddleware("compression")
+}
+
+// NewChain 用 "middlewares" 组构建 Chain：中间件按 AsMiddleware 的 priority 排列，越小越靠外。
+// 唯一的例外是名为 "recovery" 的中间件，不管 priority 是多少，它总在最外层，这样其他中间件中的 panic 也会被它捕获。
+// 重复注册的同名中间件只保留最靠外的一个，并记录一条警告，避免同一个中间件执行两次（例如访问日志写两遍）。
+// disabled 中的名字来自 WithoutMiddleware，对应的中间件不会出现在链中。
+func NewChain(log *zap.Logger, entries []middlewareEntry, disabled []string) Chain {
+	entries = slices.Clone(entries)
+	slices.SortStableFunc(entries, func(a, b middlewareEntry) int {
+		if ra, rb := isRecovery(a), isRecovery(b); ra != rb {
+			if ra {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.priority, b.priority)
+	})
+
+	// skip 记录要去掉的名字，以及链中是否确实有这个中间件。
+	skip := make(map[string]bool, len(disabled))
+	for _, name := range disabled {
+		skip[name] = false
+	}
+	chain := make(Chain, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if n, ok := e.Wrapper.(NamedMiddleware); ok {
+			if _, ok := skip[n.Name()]; ok {
+				skip[n.Name()] = true
+				continue
+			}
+			if seen[n.Name()] {
+				log.Warn("Ignoring duplicate middleware", zap.String("name", n.Name()))
+				continue
+			}
+			seen[n.Name()] = true
+		}
+		chain = append(chain, e.Wrap)
+	}
+	for name, found := range skip {
+		if found {
+			log.Info("Middleware disabled", zap.String("name", name))
+		} else {
+			log.Warn("Cannot disable unknown middleware", zap.String("name", name))
+		}
+	}
+	return chain
+}
+
+func isRecovery(e middlewareEntry) bool {
+	n, ok := e.Wrapper.(NamedMiddleware)
+	return ok && n.Name() == "recovery"
+}
+
+// Then 用链中的中间件包装 h：请求依次经过 c[0]、c[1]……最后到达 h。
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// NewHandler 用中间件链包装路由器，得到服务器最终使用的 http.Handler。
+func NewHandler(mux Router, chain Chain, renderer *ErrorRenderer) http.Handler {
+	return chain.Then(notFoundHandler(mux, renderer))
+}
+
+// AdminHandler 是运维服务器使用的 http.Handler，没有配置 AdminConfig.Addr 时 Handler 为 nil。
+type AdminHandler struct {
+	http.Handler
+}
+
+// NewAdminHandler 用同一条中间件链包装运维路由器。
+func NewAdminHandler(mux AdminRouter, chain Chain, renderer *ErrorRenderer) AdminHandler {
+	if mux.Router == nil {
+		return AdminHandler{}
+	}
+	return AdminHandler{chain.Then(notFoundHandler(mux.Router, renderer))}
+}
+
+// 尾部斜杠的处理方式，见 ServerConfig.TrailingSlash。
+const (
+	TrailingSlashRedirect = "redirect"
+	TrailingSlashRewrite  = "rewrite"
+)
+
+// NewTrailingSlashMiddleware 让 /echo/ 和 /echo 走到同一个路由：按配置返回重定向，或者在内部改写路径。
+// 只有在原路径没有匹配的路由、而去掉尾部斜杠后有匹配的路由时才会处理，
+// 所以 "/static/" 这样以斜杠结尾的模式不受影响，也不会和 ServeMux 自己的重定向形成循环。
+func NewTrailingSlashMiddleware(cfg *Config, mux Router) Middleware {
+	mode := cfg.Server.TrailingSlash
+	return func(next http.Handler) http.Handler {
+		if mode != TrailingSlashRedirect && mode != TrailingSlashRewrite {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			trimmed := strings.TrimRight(path, "/")
+			// "//example.com/" 去掉斜杠后会变成协议相对地址，不能用来重定向。
+			if trimmed == path || trimmed == "" || strings.HasPrefix(trimmed, "//") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if mux.Match(r) != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			normalized := *r.URL
+			normalized.Path = trimmed
+			normalized.RawPath = ""
+			r2 := r.Clone(r.Context())
+			r2.URL = &normalized
+			if mux.Match(r2) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if mode == TrailingSlashRewrite {
+				next.ServeHTTP(w, r2)
+				return
+			}
+			// 301 会让客户端把 POST 改成 GET，所以非 GET/HEAD 请求使用保留方法和请求体的 308。
+			status := http.StatusMovedPermanently
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				status = http.StatusPermanentRedirect
+			}
+			http.Redirect(w, r, normalized.RequestURI(), status)
+		})
+	}
+}
+
+// NewHeadMiddleware 处理 HEAD 请求：处理程序照常运行，但写出的响应体会被丢弃。
+// 响应头会一直推迟到处理程序返回，这样可以像 GET 请求一样补上 Content-Length 和 Content-Type，
+// 处理程序本身不需要区分 HEAD。
+func NewHeadMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			hw := &headWriter{ResponseWriter: w}
+			next.ServeHTTP(hw, r)
+			hw.finish()
+		})
+	}
+}
+
+// headWriter 丢弃响应体，只记录状态码和长度。
+type headWriter struct {
+	http.ResponseWriter
+	status      int
+	length      int64
+	wroteHeader bool
+}
+
+func (w *headWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *headWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.Header()
+	if w.length == 0 && len(b) > 0 && h.Get("Content-Type") == "" && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Type", http.DetectContentType(b))
+	}
+	w.length += int64(len(b))
+	return len(b), nil
+}
+
+// Flush 意味着处理程序在流式输出，此时无法知道最终长度，只能立即发送响应头。
+func (w *headWriter) Flush() {
+	w.writeHeader(false)
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *headWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *headWriter) finish() {
+	w.writeHeader(true)
+}
+
+func (w *headWriter) writeHeader(withLength bool) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if withLength && w.length > 0 && w.Header().Get("Content-Length") == "" {
+		w.Header().Set("Content-Length", strconv.FormatInt(w.length, 10))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// NewQueryGuardMiddleware 拒绝查询参数过多或查询字符串过长的请求，返回 400，用于防御参数污染攻击。
+// 限制来自 ServerConfig，值为 0 的限制不生效。
+func NewQueryGuardMiddleware(cfg *Config, renderer *ErrorRenderer) Middleware {
+	maxParams, maxLength := cfg.Server.MaxQueryParams, cfg.Server.MaxQueryLength
+	return func(next http.Handler) http.Handler {
+		if maxParams <= 0 && maxLength <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.RawQuery
+			// 先检查长度，避免为超长的查询字符串计数。
+			if maxLength > 0 && len(query) > maxLength {
+				renderer.Render(w, r, http.StatusBadRequest, "query string too long")
+				return
+			}
+			if maxParams > 0 && countQueryParams(query) > maxParams {
+				renderer.Render(w, r, http.StatusBadRequest, "too many query parameters")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// countQueryParams 返回查询字符串中非空参数的个数，与 url.ParseQuery 的拆分方式一致，但不分配内存。
+func countQueryParams(query string) int {
+	n := 0
+	for query != "" {
+		var param string
+		param, query, _ = strings.Cut(query, "&")
+		if param != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// BodyLimitedRoute 是一个可选接口。实现了它的 Route 使用自己的请求体上限，而不是 ServerConfig.MaxRequestBody。
+// MaxBodyBytes 返回 0 表示不限制。
+type BodyLimitedRoute interface {
+	Route
+	MaxBodyBytes() int64
+}
+
+type bodyLimitParams struct {
+	fx.In
+
+	Config      *Config
+	Renderer    *ErrorRenderer
+	Router      Router
+	Routes      []Route      `group:"routes"`
+	VHostRoutes []vhostRoute `group:"vhost_routes"`
+}
+
+// limits 返回查找请求体上限的函数，0 表示不限制；没有任何路由受限时 unlimited 为 true。
+func (p bodyLimitParams) limits() (limitFor func(*http.Request) int64, unlimited bool) {
+	// 中间件位于路由器之外，按 Router.Match 返回的模式查找路由的上限。
+	limits := newRouteLookup(p.Router, p.Routes, p.VHostRoutes, func(route Route) (int64, bool) {
+		r, ok := routeAs[BodyLimitedRoute](route)
+		if !ok {
+			return 0, false
+		}
+		return r.MaxBodyBytes(), true
+	})
+	global := p.Config.Server.MaxRequestBody
+	return func(r *http.Request) int64 {
+		if limit, ok := limits.lookup(r); ok {
+			return limit
+		}
+		return global
+	}, global <= 0 && limits.empty()
+}
+
+// NewBodyLimitMiddleware 限制请求体的大小：优先使用路由通过 BodyLimitedRoute 声明的上限，否则使用 ServerConfig.MaxRequestBody。
+// 声明的 Content-Length 超出限制时直接返回 413，不读取请求体。net/http 只有在处理程序第一次读取请求体时
+// 才会回复 "100 Continue"，所以使用 Expect: 100-continue 的客户端在上传之前就会收到拒绝，而不必发送整个请求体。
+// 没有声明长度（分块传输）的请求由 http.MaxBytesReader 在读取时限制。
+func NewBodyLimitMiddleware(p bodyLimitParams) Middleware {
+	limitFor, unlimited := p.limits()
+	return func(next http.Handler) http.Handler {
+		if unlimited {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := limitFor(r)
+			if limit <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > limit {
+				p.Renderer.Render(w, r, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Inasayang/fxdemo/8_build_a_real_service/internal/logtest"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// trailingSlashMux 注册 /echo 和以斜杠结尾的 /static/，处理程序把收到的路径写进响应体。
+func trailingSlashMux() Router {
+	mux := NewRouterProvider().NewRouter()
+	echoPath := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})
+	mux.Handle("/echo", echoPath)
+	mux.Handle("/static/", echoPath)
+	return mux
+}
+
+func TestTrailingSlashMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		method       string
+		target       string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{name: "redirect GET", mode: TrailingSlashRedirect, method: http.MethodGet, target: "/echo/?x=1", wantStatus: http.StatusMovedPermanently, wantLocation: "/echo?x=1"},
+		{name: "redirect POST keeps method", mode: TrailingSlashRedirect, method: http.MethodPost, target: "/echo/", wantStatus: http.StatusPermanentRedirect, wantLocation: "/echo"},
+		{name: "redirect without slash", mode: TrailingSlashRedirect, method: http.MethodGet, target: "/echo", wantStatus: http.StatusOK, wantBody: "/echo"},
+		{name: "rewrite", mode: TrailingSlashRewrite, method: http.MethodPost, target: "/echo//", wantStatus: http.StatusOK, wantBody: "/echo"},
+		{name: "rewrite without slash", mode: TrailingSlashRewrite, method: http.MethodGet, target: "/echo", wantStatus: http.StatusOK, wantBody: "/echo"},
+		{name: "slash pattern untouched", mode: TrailingSlashRedirect, method: http.MethodGet, target: "/static/", wantStatus: http.StatusOK, wantBody: "/static/"},
+		{name: "no route without slash", mode: TrailingSlashRedirect, method: http.MethodGet, target: "/missing/", wantStatus: http.StatusNotFound},
+		// 交给 ServeMux 清理路径，而不是重定向到协议相对地址 "//example.com"。
+		{name: "protocol-relative path", mode: TrailingSlashRedirect, method: http.MethodGet, target: "//example.com/", wantStatus: http.StatusTemporaryRedirect, wantLocation: "/example.com/"},
+		{name: "disabled", mode: "", method: http.MethodGet, target: "/echo/", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := trailingSlashMux()
+			cfg := &Config{Server: ServerConfig{TrailingSlash: tt.mode}}
+			h := NewTrailingSlashMiddleware(cfg, mux)(mux)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// HEAD /hello 的状态码和响应头与 GET 相同，但没有响应体。
+func TestHeadMiddleware(t *testing.T) {
+	h := NewHeadMiddleware()(NewHelloHandler(zap.NewNop(), testRenderer(t)))
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/hello", nil))
+
+	tests := []struct {
+		method            string
+		wantBody          string
+		wantContentLength string
+	}{
+		{method: http.MethodGet, wantBody: get.Body.String()},
+		{method: http.MethodHead, wantBody: "", wantContentLength: strconv.Itoa(get.Body.Len())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/hello", nil))
+			if rec.Code != get.Code {
+				t.Errorf("status = %d, want %d", rec.Code, get.Code)
+			}
+			if got, want := rec.Header().Get("Content-Type"), get.Header().Get("Content-Type"); got != want {
+				t.Errorf("Content-Type = %q, want %q", got, want)
+			}
+			if got := rec.Header().Get("Content-Length"); got != tt.wantContentLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantContentLength)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestQueryGuardMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name       string
+		maxParams  int
+		maxLength  int
+		query      string
+		wantStatus int
+	}{
+		{name: "within limits", maxParams: 2, maxLength: 16, query: "a=1&b=2", wantStatus: http.StatusOK},
+		{name: "empty params not counted", maxParams: 2, maxLength: 16, query: "a=1&&b=2&", wantStatus: http.StatusOK},
+		{name: "too many params", maxParams: 2, maxLength: 16, query: "a=1&b=2&c=3", wantStatus: http.StatusBadRequest},
+		{name: "too long", maxParams: 2, maxLength: 16, query: "a=" + strings.Repeat("x", 15), wantStatus: http.StatusBadRequest},
+		{name: "disabled", query: "a=1&b=2&c=3&" + strings.Repeat("x", 100), wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Server: ServerConfig{MaxQueryParams: tt.maxParams, MaxQueryLength: tt.maxLength}}
+			h := NewQueryGuardMiddleware(cfg, testRenderer(t))(ok)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/echo?"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// tagMiddleware 在响应体中追加 tag，用来观察中间件的执行顺序。
+func tagMiddleware(tag string) func() Middleware {
+	return func() Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tag))
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+}
+
+// chainOrder 用 opts 中注册的中间件构建 Chain，返回请求经过各个中间件的顺序。
+func chainOrder(t *testing.T, log *zap.Logger, opts ...fx.Option) string {
+	var chain Chain
+	fxtest.New(t,
+		fx.Options(opts...),
+		fx.Supply(log),
+		fx.Provide(fx.Annotate(NewChain, fx.ParamTags(``, `group:"middlewares"`, `group:"disabled_middlewares"`))),
+		fx.Populate(&chain),
+	).RequireStart().RequireStop()
+
+	rec := httptest.NewRecorder()
+	chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("h"))
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Body.String()
+}
+
+func TestChainOrdersByPriority(t *testing.T) {
+	got := chainOrder(t, zap.NewNop(),
+		AsMiddleware(tagMiddleware("c"), 300),
+		AsMiddleware(tagMiddleware("a"), 100),
+		AsMiddleware(tagMiddleware("b"), 200),
+	)
+	if got != "abch" {
+		t.Errorf("order = %q, want %q", got, "abch")
+	}
+}
+
+// namedTagMiddleware 和 tagMiddleware 一样，但带有名字 tag。
+func namedTagMiddleware(tag string) func() Wrapper {
+	return func() Wrapper {
+		return Named(tag, tagMiddleware(tag)())
+	}
+}
+
+func TestChainIgnoresDuplicateNamedMiddleware(t *testing.T) {
+	log, logs := logtest.NewObservedLogger()
+	got := chainOrder(t, log,
+		AsMiddleware(namedTagMiddleware("a"), 300),
+		AsMiddleware(tagMiddleware("b"), 200),
+		AsMiddleware(namedTagMiddleware("a"), 100),
+	)
+	// 保留最靠外的 a。
+	if got != "abh" {
+		t.Errorf("order = %q, want %q", got, "abh")
+	}
+	warnings := logs.FilterMessage("Ignoring duplicate middleware").All()
+	if len(warnings) != 1 || warnings[0].ContextMap()["name"] != "a" {
+		t.Errorf("warnings = %v, want one for %q", warnings, "a")
+	}
+}
+
+func TestWithoutLogging(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []fx.Option
+		wantLog int
+	}{
+		{name: "default", wantLog: 1},
+		{name: "without logging", opts: []fx.Option{WithoutLogging()}, wantLog: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, logs := logtest.NewObservedLogger()
+			got := chainOrder(t, log, append(tt.opts,
+				fx.Supply(&Config{}),
+				AsMiddleware(NewLoggingMiddleware, 100),
+				AsMiddleware(tagMiddleware("a"), 200),
+			)...)
+			if got != "ah" {
+				t.Errorf("order = %q, want %q", got, "ah")
+			}
+			if n := logs.FilterMessage("Request completed").Len(); n != tt.wantLog {
+				t.Errorf("got %d access log entries, want %d", n, tt.wantLog)
+			}
+		})
+	}
+}
+
+// recovery 即使优先级更大也位于最外层，能接住其他中间件中的 panic。
+func TestRecoveryIsOutermost(t *testing.T) {
+	log, logs := logtest.NewObservedLogger()
+	var chain Chain
+	fxtest.New(t,
+		AsMiddleware(func() Middleware {
+			return func(http.Handler) http.Handler {
+				return http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("boom") })
+			}
+		}, 10),
+		AsMiddleware(NewRecoveryMiddleware, 500),
+		fx.Supply(log, &Config{}, testRenderer(t)),
+		fx.Provide(fx.Annotate(NewChain, fx.ParamTags(``, `group:"middlewares"`, `group:"disabled_middlewares"`))),
+		fx.Populate(&chain),
+	).RequireStart().RequireStop()
+
+	rec := httptest.NewRecorder()
+	chain.Then(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if n := logs.FilterMessage("Recovered from panic").Len(); n != 1 {
+		t.Errorf("got %d panic log entries, want 1", n)
+	}
+}
+
+// limitedRoute 读取整个请求体，超出上限时返回 413。
+type limitedRoute struct {
+	pattern string
+	limit   int64
+}
+
+func (r limitedRoute) Pattern() string     { return r.pattern }
+func (r limitedRoute) MaxBodyBytes() int64 { return r.limit }
+
+func (limitedRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var maxErr *http.MaxBytesError
+	if _, err := io.ReadAll(r.Body); errors.As(err, &maxErr) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestBodyLimitMiddlewarePerRoute(t *testing.T) {
+	routes := []Route{limitedRoute{pattern: "/small", limit: 4}, limitedRoute{pattern: "/big", limit: 16}}
+	mux := NewRouterProvider().NewRouter()
+	for _, route := range routes {
+		mux.Handle(route.Pattern(), route)
+	}
+	h := NewBodyLimitMiddleware(bodyLimitParams{
+		Config:   &Config{Server: ServerConfig{MaxRequestBody: 1024}},
+		Renderer: testRenderer(t),
+		Router:   mux,
+		Routes:   routes,
+	})(mux)
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		chunked    bool
+		wantStatus int
+	}{
+		{name: "small within limit", target: "/small", body: "abcd", wantStatus: http.StatusOK},
+		{name: "small over limit", target: "/small", body: "abcde", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "big within limit", target: "/big", body: "abcdefghij", wantStatus: http.StatusOK},
+		{name: "big over limit", target: "/big", body: strings.Repeat("x", 17), wantStatus: http.StatusRequestEntityTooLarge},
+		// 没有 Content-Length 时由 http.MaxBytesReader 在读取时限制。
+		{name: "chunked over limit", target: "/small", body: "abcde", chunked: true, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
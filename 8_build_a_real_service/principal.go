@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+type principalKey struct{}
+
+// principalSlot 由 LoggingMiddleware 放进 context。WithPrincipal 返回的是新的请求，外层的中间件看不到它的 context，
+// 所以 WithPrincipal 同时把 principal 写进这里，访问日志和路由统计在请求结束后从这里读取。
+type principalSlot struct {
+	principal atomic.Pointer[string]
+}
+
+type principalSlotKey struct{}
+
+// WithPrincipal 由认证中间件或处理程序在认证成功后调用，返回带有 principal 的请求。
+// 之后请求日志记录器的每一行日志、访问日志和路由统计都会带上它。principal 会成为指标的标签，
+// 所以必须是低基数的标识，例如客户端 ID，而不是用户的邮箱地址。
+func WithPrincipal(r *http.Request, principal string) *http.Request {
+	ctx := context.WithValue(r.Context(), principalKey{}, principal)
+	if slot, ok := ctx.Value(principalSlotKey{}).(*principalSlot); ok {
+		slot.principal.Store(&principal)
+	}
+	if log, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		ctx = context.WithValue(ctx, loggerKey{}, log.With(zap.String("principal", principal)))
+	}
+	return r.WithContext(ctx)
+}
+
+// PrincipalFromContext 返回 WithPrincipal 设置的 principal，请求没有经过认证时返回空字符串。
+func PrincipalFromContext(ctx context.Context) string {
+	if principal, ok := ctx.Value(principalKey{}).(string); ok {
+		return principal
+	}
+	if slot, ok := ctx.Value(principalSlotKey{}).(*principalSlot); ok {
+		if p := slot.principal.Load(); p != nil {
+			return *p
+		}
+	}
+	return ""
+}
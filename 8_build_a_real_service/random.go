@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// lockedSource 让 rand.Source 可以被多个 goroutine 同时使用。
+// rand.Rand 本身没有其他状态，所以基于它的 *rand.Rand 也是并发安全的。
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+// NewRand 返回处理程序和中间件共用的随机数生成器，用于抖动、采样等，而不是使用 math/rand 的全局状态。
+// RandomConfig.Seed 为 0 时使用随机的种子；种子总会被记录下来，需要复现时把它写回配置即可。
+// 测试可以用固定的种子得到可重复的结果。
+func NewRand(cfg *Config, log *zap.Logger) *rand.Rand {
+	seed := cfg.Random.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	log.Info("Seeded random source", zap.Uint64("seed", seed))
+	return rand.New(&lockedSource{src: rand.NewPCG(seed, seed)})
+}
+
+// jitter 返回 [d/2, d] 之间的随机时长。重试前按它等待，多个实例就不会在同一时刻重试。
+func jitter(r *rand.Rand, d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(r.Int64N(int64(d-half)+1))
+}
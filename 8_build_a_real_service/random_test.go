@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func testRand(t *testing.T, seed uint64) *rand.Rand {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.Random.Seed = seed
+	return NewRand(cfg, zap.NewNop())
+}
+
+func jitters(r *rand.Rand, d time.Duration, n int) []time.Duration {
+	out := make([]time.Duration, n)
+	for i := range out {
+		out[i] = jitter(r, d)
+	}
+	return out
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+	}{
+		{name: "zero", d: 0},
+		{name: "one nanosecond", d: 1},
+		{name: "two nanoseconds", d: 2},
+		{name: "backoff", d: 100 * time.Millisecond},
+		{name: "max backoff", d: maxWorkerBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRand(t, 1)
+			for _, got := range jitters(r, tt.d, 100) {
+				if tt.d <= 1 && got != tt.d {
+					t.Fatalf("jitter(%v) = %v, want %v", tt.d, got, tt.d)
+				}
+				if got < tt.d/2 || got > tt.d {
+					t.Fatalf("jitter(%v) = %v, want between %v and %v", tt.d, got, tt.d/2, tt.d)
+				}
+			}
+		})
+	}
+}
+
+func TestJitterReproducible(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  uint64
+		equal bool
+	}{
+		{name: "same seed", a: 42, b: 42, equal: true},
+		{name: "different seed", a: 42, b: 43, equal: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := jitters(testRand(t, tt.a), time.Second, 8)
+			b := jitters(testRand(t, tt.b), time.Second, 8)
+			if slices.Equal(a, b) != tt.equal {
+				t.Errorf("jitters with seeds %d and %d: %v and %v, want equal %v", tt.a, tt.b, a, b, tt.equal)
+			}
+		})
+	}
+}
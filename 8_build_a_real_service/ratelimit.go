@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// RateLimitSettings 是限流的参数：每个客户端每秒 Rate 个请求，最多累积 Burst 个。Rate 为 0 表示不限流。
+type RateLimitSettings struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+func (s RateLimitSettings) validate() error {
+	if s.Rate < 0 || math.IsNaN(s.Rate) || math.IsInf(s.Rate, 0) {
+		return fmt.Errorf("invalid rate %v", s.Rate)
+	}
+	if s.Rate > 0 && s.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1, got %d", s.Burst)
+	}
+	return nil
+}
+
+// RateLimiter 按客户端 IP 用令牌桶限流。参数保存在 atomic.Pointer 中，可以在运行时通过 Update 替换，
+// 不需要重启，也不会阻塞正在处理的请求；新的参数从每个客户端的下一个请求开始生效。
+type RateLimiter struct {
+	settings atomic.Pointer[RateLimitSettings]
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket 是一个客户端的令牌桶。
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxRateLimitBuckets 是保留的令牌桶数量的上限，超过后清理已经回满的令牌桶。
+const maxRateLimitBuckets = 10000
+
+func NewRateLimiter(cfg *Config) *RateLimiter {
+	l := &RateLimiter{buckets: make(map[string]*tokenBucket)}
+	s := RateLimitSettings{Rate: cfg.RateLimit.Rate, Burst: cfg.RateLimit.Burst}
+	l.settings.Store(&s)
+	return l
+}
+
+// Settings 返回当前的参数。
+func (l *RateLimiter) Settings() RateLimitSettings {
+	return *l.settings.Load()
+}
+
+// Update 替换限流参数。
+func (l *RateLimiter) Update(s RateLimitSettings) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	l.settings.Store(&s)
+	return nil
+}
+
+// allow 报告 key 的请求是否可以通过；不能通过时 retryAfter 是下一个令牌产生前的等待时间。
+func (l *RateLimiter) allow(key string, now time.Time) (ok bool, retryAfter time.Duration) {
+	s := l.Settings()
+	if s.Rate <= 0 {
+		return true, 0
+	}
+	burst := float64(s.Burst)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, found := l.buckets[key]
+	if !found {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.sweep(now, s)
+		}
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*s.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / s.Rate * float64(time.Second))
+}
+
+// sweep 删除已经回满的令牌桶，它们和新建的令牌桶没有区别。调用方必须持有 l.mu。
+func (l *RateLimiter) sweep(now time.Time, s RateLimitSettings) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*s.Rate >= float64(s.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+type rateLimitParams struct {
+	fx.In
+
+	Limiter     *RateLimiter
+	Renderer    *ErrorRenderer
+	Router      Router
+	Routes      []Route      `group:"routes"`
+	VHostRoutes []vhostRoute `group:"vhost_routes"`
+}
+
+// NewRateLimitMiddleware 对超过限流的客户端返回 429 和 Retry-After。客户端按 RemoteAddr 的 IP 区分。
+// 运维接口（AdminRoute）不受限流，否则参数设得太低时，运维人员就无法再通过 /admin/ratelimit 调回来。
+func NewRateLimitMiddleware(p rateLimitParams) Middleware {
+	exempt := newRouteLookup(p.Router, p.Routes, p.VHostRoutes, routeIs(isAdminRoute))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt.has(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := r.RemoteAddr
+			if addr, err := clientAddr(r); err == nil {
+				key = addr.String()
+			}
+			ok, retryAfter := p.Limiter.allow(key, time.Now())
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				p.Renderer.Render(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitHandler 处理 /admin/ratelimit：GET 返回当前的限流参数，PUT 用请求体替换它们。
+// 请求体和响应的格式由 Codecs 协商，默认是 JSON。
+type RateLimitHandler struct {
+	log      *zap.Logger
+	limiter  *RateLimiter
+	renderer *ErrorRenderer
+	codecs   *Codecs
+}
+
+func NewRateLimitHandler(log *zap.Logger, limiter *RateLimiter, renderer *ErrorRenderer, codecs *Codecs) *RateLimitHandler {
+	return &RateLimitHandler{log: log, limiter: limiter, renderer: renderer, codecs: codecs}
+}
+
+func (*RateLimitHandler) Pattern() string {
+	return "/admin/ratelimit"
+}
+
+func (*RateLimitHandler) Admin() bool {
+	return true
+}
+
+func (*RateLimitHandler) Methods() []string {
+	return []string{http.MethodGet, http.MethodPut}
+}
+
+func (h *RateLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var s RateLimitSettings
+		if err := h.codecs.Decode(r, &s); errors.Is(err, errUnsupportedMediaType) {
+			h.renderer.Render(w, r, http.StatusUnsupportedMediaType, err.Error())
+			return
+		} else if err != nil {
+			h.renderer.Render(w, r, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if err := h.limiter.Update(s); err != nil {
+			h.renderer.Render(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		loggerFrom(r.Context(), h.log).Info("Rate limit updated", zap.Float64("rate", s.Rate), zap.Int("burst", s.Burst))
+	}
+
+	if err := h.codecs.Write(w, r, http.StatusOK, h.limiter.Settings()); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
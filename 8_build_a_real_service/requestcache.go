@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// RequestCache 是只在一个请求内有效的缓存，让多个中间件和处理程序共享同一个计算结果（例如解析出的认证信息），
+// 而不必各自重新计算。它可以被并发使用。
+type RequestCache struct {
+	mu     sync.Mutex
+	values map[any]any
+}
+
+type requestCacheKey struct{}
+
+// RequestCacheFromContext 返回当前请求的 RequestCache，不在请求中时返回 nil。nil 的 RequestCache 可以使用，但不缓存任何值。
+func RequestCacheFromContext(ctx context.Context) *RequestCache {
+	c, _ := ctx.Value(requestCacheKey{}).(*RequestCache)
+	return c
+}
+
+// Get 返回 key 对应的值。和 context 的键一样，key 最好使用未导出的类型，避免不同的包互相覆盖。
+func (c *RequestCache) Get(key any) (any, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// Set 保存 key 对应的值。
+func (c *RequestCache) Set(key, value any) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+}
+
+// Memoize 返回当前请求中 key 对应的值，没有时调用 compute 计算并缓存。compute 返回错误时不缓存。
+// 两个组件同时计算同一个 key 时，compute 可能被调用两次，以最后保存的结果为准。
+func Memoize[T any](ctx context.Context, key any, compute func() (T, error)) (T, error) {
+	c := RequestCacheFromContext(ctx)
+	if v, ok := c.Get(key); ok {
+		if t, ok := v.(T); ok {
+			return t, nil
+		}
+	}
+	t, err := compute()
+	if err != nil {
+		return t, err
+	}
+	c.Set(key, t)
+	return t, nil
+}
+
+// NewRequestCacheMiddleware 为每个请求创建一个空的 RequestCache 并放进 context。
+func NewRequestCacheMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := &RequestCache{values: make(map[any]any)}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestCacheKey{}, c)))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testCacheKey struct{}
+
+func TestMemoize(t *testing.T) {
+	errCompute := errors.New("compute failed")
+	tests := []struct {
+		name      string
+		cached    bool
+		err       error
+		wantCalls int
+	}{
+		{name: "cached within request", cached: true, wantCalls: 1},
+		{name: "errors are not cached", cached: true, err: errCompute, wantCalls: 2},
+		{name: "outside a request", cached: false, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			compute := func() (int, error) {
+				calls++
+				return 42, tt.err
+			}
+			run := func(ctx context.Context) {
+				for range 2 {
+					v, err := Memoize(ctx, testCacheKey{}, compute)
+					if !errors.Is(err, tt.err) {
+						t.Errorf("Memoize() error = %v, want %v", err, tt.err)
+					}
+					if err == nil && v != 42 {
+						t.Errorf("Memoize() = %d, want 42", v)
+					}
+				}
+			}
+
+			if tt.cached {
+				h := NewRequestCacheMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					run(r.Context())
+				}))
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			} else {
+				run(context.Background())
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("compute called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// HTTPS 重定向、限流和运维接口的白名单在同一个请求内共用 clientAddr 的解析结果。
+func TestClientAddrSharedWithinRequest(t *testing.T) {
+	var first, second string
+	h := NewRequestCacheMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, _ := clientAddr(r)
+		first = addr.String()
+		// 后面的组件读到的是缓存的结果，而不是重新解析 RemoteAddr。
+		r.RemoteAddr = "198.51.100.7:80"
+		addr, _ = clientAddr(r)
+		second = addr.String()
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if first != "192.0.2.1" || second != first {
+		t.Errorf("clientAddr() = %q then %q, want 192.0.2.1 both times", first, second)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// RequestIDHeader 是默认携带请求 ID 的请求头和响应头，见 RequestIDConfig。
+const RequestIDHeader = "X-Request-ID"
+
+// IDGenerator 生成请求 ID。默认实现生成随机的 UUID；
+// 测试可以用 fx.Decorate 换成返回固定序列的实现，让对请求 ID 的断言保持稳定。
+type IDGenerator interface {
+	Next() string
+}
+
+// uuidGenerator 生成第 4 版（随机）UUID。
+type uuidGenerator struct{}
+
+func NewIDGenerator() IDGenerator {
+	return uuidGenerator{}
+}
+
+func (uuidGenerator) Next() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // 版本 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 变体
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext 返回 RequestIDMiddleware 为当前请求分配的 ID，没有时返回空字符串。
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestIDMiddleware 为每个请求分配 ID：按 RequestIDConfig.Headers 的顺序沿用上游传入的第一个有效的 ID，
+// 都没有时由 IDGenerator 生成。ID 写入 RequestIDConfig.ResponseHeader，并保存在请求的 context 中。
+func NewRequestIDMiddleware(gen IDGenerator, cfg *Config) Middleware {
+	headers, respHeader := cfg.RequestID.Headers, cfg.RequestID.ResponseHeader
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var id string
+			for _, h := range headers {
+				if v := r.Header.Get(h); v != "" && len(v) <= 128 {
+					id = v
+					break
+				}
+			}
+			if id == "" {
+				id = gen.Next()
+			}
+			w.Header().Set(respHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
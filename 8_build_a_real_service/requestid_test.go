@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+// seqGenerator 依次返回 req-1、req-2……
+type seqGenerator struct{ n int }
+
+func (g *seqGenerator) Next() string {
+	g.n++
+	return fmt.Sprintf("req-%d", g.n)
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var mw Middleware
+	cfg := &Config{RequestID: RequestIDConfig{
+		Headers:        []string{"X-Correlation-ID", RequestIDHeader},
+		ResponseHeader: RequestIDHeader,
+	}}
+	fxtest.New(t,
+		fx.Supply(cfg),
+		fx.Provide(NewIDGenerator, NewRequestIDMiddleware),
+		fx.Decorate(func(IDGenerator) IDGenerator { return &seqGenerator{} }),
+		fx.Populate(&mw),
+	).RequireStart().RequireStop()
+
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RequestIDFromContext(r.Context())))
+	}))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "generated", want: "req-1"},
+		{name: "incoming kept", headers: map[string]string{RequestIDHeader: "upstream-id"}, want: "upstream-id"},
+		{name: "first header wins", headers: map[string]string{RequestIDHeader: "upstream-id", "X-Correlation-ID": "corr-id"}, want: "corr-id"},
+		{name: "too long replaced", headers: map[string]string{RequestIDHeader: strings.Repeat("x", 129)}, want: "req-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if got := rec.Header().Get(RequestIDHeader); got != tt.want {
+				t.Errorf("%s = %q, want %q", RequestIDHeader, got, tt.want)
+			}
+			if rec.Body.String() != tt.want {
+				t.Errorf("context ID = %q, want %q", rec.Body, tt.want)
+			}
+		})
+	}
+}
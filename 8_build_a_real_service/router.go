@@ -0,0 +1,46 @@
+package main
+
+import "net/http"
+
+// Router 是服务器对路由器的全部要求。默认实现基于 http.ServeMux；
+// 换用 chi、gorilla/mux 等路由器时，用一个适配器实现这个接口。
+// 路由的模式使用 ServeMux 的语法（例如 "GET /items/{id}"），适配器需要把它转换成自己的语法。
+type Router interface {
+	http.Handler
+
+	// Handle 注册一个模式。模式无效或与已注册的模式冲突时可以 panic，NewRouter 会把它转换为错误。
+	Handle(pattern string, h http.Handler)
+
+	// Match 返回匹配 r 的模式，没有匹配的路由时返回空字符串。
+	// 404 页面、尾部斜杠处理和慢请求记录都依赖它。
+	Match(r *http.Request) string
+}
+
+// RouterProvider 创建一个空的 Router，NewRouter 再把 "routes" 组中的路由注册上去。
+// 缓存、访问限制、超时等按路由的包装由 NewRouter 负责，与具体的路由器无关，所以替换路由器只需要替换它：
+//
+//	fx.Decorate(func(RouterProvider) RouterProvider { return chiRouterProvider{} })
+type RouterProvider interface {
+	NewRouter() Router
+}
+
+// serveMuxProvider 是默认的 RouterProvider。
+type serveMuxProvider struct{}
+
+func NewRouterProvider() RouterProvider {
+	return serveMuxProvider{}
+}
+
+func (serveMuxProvider) NewRouter() Router {
+	return serveMux{http.NewServeMux()}
+}
+
+// serveMux 让 http.ServeMux 满足 Router。
+type serveMux struct {
+	*http.ServeMux
+}
+
+func (m serveMux) Match(r *http.Request) string {
+	_, pattern := m.Handler(r)
+	return pattern
+}
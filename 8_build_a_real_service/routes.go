@@ -0,0 +1,443 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/fx"
+)
+
+type Route interface {
+	http.Handler
+	Pattern() string
+}
+
+// TimeoutRoute 是一个可选接口。实现了它的 Route 使用自己的超时时间，而不是 ServerConfig.RequestTimeout。
+// Timeout 返回 0 表示不限制，适用于流式响应等长时间运行的处理程序。
+type TimeoutRoute interface {
+	Route
+	Timeout() time.Duration
+}
+
+// MultiPatternRoute 是一个可选接口，用于响应多个路径的处理程序（例如 "/" 和 "/index.html"）。
+// 实现了它的 Route 按 Patterns 注册，Pattern 不再使用。
+type MultiPatternRoute interface {
+	Route
+	Patterns() []string
+}
+
+// MethodRoute 是一个可选接口。实现了它的 Route 只接受 Methods 返回的方法（接受 GET 时也接受 HEAD）：
+// OPTIONS 请求直接得到 204 和 Allow 头，其他方法得到 405 和同样的 Allow 头，处理程序不需要自己检查方法。
+type MethodRoute interface {
+	Route
+	Methods() []string
+}
+
+// MethodNotAllowedRoute 是一个可选接口，与 MethodRoute 一起使用：MethodNotAllowedMessage 是 405 响应中的说明。
+type MethodNotAllowedRoute interface {
+	Route
+	MethodNotAllowedMessage() string
+}
+
+// routePatterns 返回路由要注册的全部模式。
+func routePatterns(route Route) []string {
+	if r, ok := routeAs[MultiPatternRoute](route); ok {
+		return r.Patterns()
+	}
+	return []string{route.Pattern()}
+}
+
+// routeLookup 为位于路由器之外的中间件按请求查找路由上的值，例如请求体上限或者是否是探针。
+// 同一个模式可以同时出现在 "routes" 组和某个虚拟主机的路由组里，所以值按路由组和模式保存，
+// 查找时先用 VHostMux 确定请求交给了哪个路由组，再用 Router.Match 返回的模式。
+type routeLookup[V any] struct {
+	router Router
+	values map[string]map[string]V // 路由组的名字（"routes" 组为空字符串）→ 模式 → 值
+}
+
+// newRouteLookup 为 routes 和 vhostRoutes 中 value 返回 true 的每个路由的每个模式记录值。
+func newRouteLookup[V any](router Router, routes []Route, vhostRoutes []vhostRoute, value func(Route) (V, bool)) routeLookup[V] {
+	l := routeLookup[V]{router: router, values: make(map[string]map[string]V)}
+	add := func(group string, route Route) {
+		v, ok := value(route)
+		if !ok {
+			return
+		}
+		if l.values[group] == nil {
+			l.values[group] = make(map[string]V)
+		}
+		for _, pattern := range routePatterns(route) {
+			l.values[group][pattern] = v
+		}
+	}
+	for _, route := range routes {
+		add("", route)
+	}
+	for _, vr := range vhostRoutes {
+		add(vr.group, vr.route)
+	}
+	return l
+}
+
+// lookup 返回匹配 r 的路由上记录的值。
+func (l routeLookup[V]) lookup(r *http.Request) (V, bool) {
+	var group string
+	if m, ok := l.router.(*VHostMux); ok {
+		group = m.group(r)
+	}
+	v, ok := l.values[group][l.router.Match(r)]
+	return v, ok
+}
+
+func (l routeLookup[V]) has(r *http.Request) bool {
+	_, ok := l.lookup(r)
+	return ok
+}
+
+func (l routeLookup[V]) empty() bool {
+	return len(l.values) == 0
+}
+
+// routeIs 把判断路由的函数转换成 newRouteLookup 的 value 参数。
+func routeIs(pred func(Route) bool) func(Route) (bool, bool) {
+	return func(route Route) (bool, bool) {
+		ok := pred(route)
+		return ok, ok
+	}
+}
+
+type routerParams struct {
+	fx.In
+
+	Routes      []Route      `group:"routes"`
+	VHostRoutes []vhostRoute `group:"vhost_routes"`
+	Config      *Config
+	Provider    RouterProvider
+	Cache       CacheMiddleware
+	Admin       AdminMiddleware
+	CSRF        CSRFMiddleware
+	Renderer    *ErrorRenderer
+	Table       *RouteTable
+}
+
+// NewRouter 用 RouterProvider 创建路由器并注册所有路由。配置了 AdminConfig.Addr 时，运维路由由 NewAdminRouter 注册，
+// 不在这里。没有任何路由并且开启了维护模式时，所有请求都交给维护模式的处理程序。
+// 配置了 VHostConfig.Hosts 时，返回的是以这个路由器为默认路由器的 VHostMux。
+func NewRouter(p routerParams) (Router, error) {
+	mux, err := p.newRouter()
+	if err != nil || len(p.Config.VHost.Hosts) == 0 {
+		return mux, err
+	}
+	return p.newVHostMux(mux)
+}
+
+func (p routerParams) newRouter() (Router, error) {
+	var routes []Route
+	for _, route := range p.Routes {
+		if p.Config.Admin.Addr == "" || !isAdminRoute(route) {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == 0 && p.Config.Maintenance.Enabled {
+		mux := p.Provider.NewRouter()
+		if err := handle(mux, "/", maintenanceHandler(p.Config.Maintenance.Message, p.Renderer)); err != nil {
+			return nil, err
+		}
+		return mux, nil
+	}
+	return p.build("main", routes)
+}
+
+// AdminRouter 是运维服务器的路由器，没有配置 AdminConfig.Addr 时 Router 为 nil。
+type AdminRouter struct {
+	Router
+}
+
+// NewAdminRouter 在配置了 AdminConfig.Addr 时，为运维服务器注册所有运维路由。
+func NewAdminRouter(p routerParams) (AdminRouter, error) {
+	if p.Config.Admin.Addr == "" {
+		return AdminRouter{}, nil
+	}
+	var routes []Route
+	for _, route := range p.Routes {
+		if isAdminRoute(route) {
+			routes = append(routes, route)
+		}
+	}
+	mux, err := p.build("admin", routes)
+	return AdminRouter{mux}, err
+}
+
+func isAdminRoute(route Route) bool {
+	r, ok := routeAs[AdminRoute](route)
+	return ok && r.Admin()
+}
+
+// build 按路由实现的可选接口包装每个路由，并注册到新的路由器上，name 是记录在 RouteTable 中的路由器名字。
+// 模式按字典序注册，与 "routes" 组中的顺序无关。两个路由声明了同一个模式，或者模式之间冲突时，返回错误，应用程序不会启动。
+func (p routerParams) build(name string, routes []Route) (Router, error) {
+	cfg, renderer := p.Config, p.Renderer
+	cache, admin, csrf := p.Cache, p.Admin, p.CSRF
+	type registration struct {
+		pattern string
+		route   Route
+		handler http.Handler
+	}
+	var regs []registration
+	for _, route := range routes {
+		var h http.Handler = route
+		// 并发限制在缓存之内，命中缓存的请求不占用名额。
+		if r, ok := routeAs[QueuedRoute](route); ok {
+			h = concurrencyQueue(r.MaxConcurrency(), r.MaxQueue(), r.QueueTimeout(), renderer)(h)
+		} else if r, ok := routeAs[ConcurrencyLimitedRoute](route); ok {
+			h = concurrencyLimit(r.MaxConcurrency(), renderer)(h)
+		}
+		if r, ok := routeAs[CacheableRoute](route); ok && r.Cacheable() {
+			h = cache(h)
+		}
+		if r, ok := routeAs[CSRFRoute](route); ok && r.CSRFProtected() {
+			h = csrf(h)
+		}
+		if r, ok := routeAs[MethodRoute](route); ok {
+			h = allowMethods(route, r.Methods(), renderer)(h)
+		}
+		if isAdminRoute(route) {
+			h = admin(h)
+		}
+		h = withTimeout(route, h, cfg.Server.RequestTimeout)
+		for _, pattern := range routePatterns(route) {
+			regs = append(regs, registration{pattern: pattern, route: route, handler: h})
+		}
+	}
+	// 同一个模式按处理程序的类型排序，冲突时的错误信息也是确定的。
+	sort.SliceStable(regs, func(i, j int) bool {
+		if regs[i].pattern != regs[j].pattern {
+			return regs[i].pattern < regs[j].pattern
+		}
+		return fmt.Sprintf("%T", innermost(regs[i].route)) < fmt.Sprintf("%T", innermost(regs[j].route))
+	})
+
+	mux := p.Provider.NewRouter()
+	owners := make(map[string]Route)
+	for _, reg := range regs {
+		pattern, route := reg.pattern, reg.route
+		if err := validatePattern(pattern); err != nil {
+			return nil, fmt.Errorf("%T: invalid pattern %q: %w", innermost(route), pattern, err)
+		}
+		if owner, ok := owners[pattern]; ok {
+			return nil, fmt.Errorf("pattern %q is registered by both %T and %T", pattern, innermost(owner), innermost(route))
+		}
+		owners[pattern] = route
+		if err := handle(mux, pattern, reg.handler); err != nil {
+			return nil, fmt.Errorf("%T: %w", innermost(route), err)
+		}
+		p.Table.add(routeInfo(name, pattern, route))
+	}
+	return mux, nil
+}
+
+// validatePattern 检查模式的基本格式，在注册之前给出比路由器的 panic 更清楚的错误。
+// 模式的格式是 "[METHOD ][HOST]/[PATH]"：去掉方法和主机名之后，必须以 "/" 开头。
+// ServeMux 会把 "foo/bar" 当作主机名为 foo 的模式，所以主机名必须带点或端口，例如 "example.com/..."，
+// 否则漏写了开头斜杠的路径会被悄悄地注册成一个永远匹配不到的主机。
+func validatePattern(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return errors.New("pattern is empty")
+	}
+	path := pattern
+	if method, rest, ok := strings.Cut(pattern, " "); ok && method != "" {
+		path = strings.TrimLeft(rest, " \t")
+	}
+	if path == "" {
+		return errors.New("pattern has a method but no path")
+	}
+	if i := strings.IndexByte(path, '/'); i > 0 && strings.ContainsAny(path[:i], ".:") {
+		path = path[i:]
+	}
+	if !strings.HasPrefix(path, "/") {
+		return errors.New(`path must start with "/"`)
+	}
+	return nil
+}
+
+// allowMethods 实现 MethodRoute：它在 Allow 头中列出允许的方法，再加上 HEAD（允许 GET 时）和 OPTIONS。
+func allowMethods(route Route, methods []string, renderer *ErrorRenderer) Middleware {
+	allowed := make(map[string]bool)
+	var list []string
+	add := func(method string) {
+		method = strings.ToUpper(method)
+		if !allowed[method] {
+			allowed[method] = true
+			list = append(list, method)
+		}
+	}
+	for _, method := range methods {
+		add(method)
+	}
+	if allowed[http.MethodGet] {
+		add(http.MethodHead)
+	}
+	add(http.MethodOptions)
+	allow := strings.Join(list, ", ")
+
+	var message string
+	if r, ok := routeAs[MethodNotAllowedRoute](route); ok {
+		message = r.MethodNotAllowedMessage()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodOptions:
+				w.Header().Set("Allow", allow)
+				w.WriteHeader(http.StatusNoContent)
+			case allowed[r.Method]:
+				next.ServeHTTP(w, r)
+			default:
+				w.Header().Set("Allow", allow)
+				renderer.Render(w, r, http.StatusMethodNotAllowed, message)
+			}
+		})
+	}
+}
+
+// handle 调用 mux.Handle，并把它在模式无效或与已注册的模式冲突时引发的 panic 转换为错误。
+func handle(mux Router, pattern string, h http.Handler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+	mux.Handle(pattern, h)
+	return nil
+}
+
+// maintenanceHandler 对所有请求返回 503 和维护信息。
+func maintenanceHandler(message string, renderer *ErrorRenderer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renderer.Render(w, r, http.StatusServiceUnavailable, message)
+	})
+}
+
+// withTimeout 用 http.TimeoutHandler 包装路由的处理程序 h，优先使用路由自己声明的超时时间。
+// http.TimeoutHandler 写出响应时，处理程序设置的响应头会覆盖外层中间件事先设置的同名响应头，
+// 所以外层中间件要在写出响应头时才添加 Vary 之类的多值响应头，见 compressWriter。
+func withTimeout(route Route, h http.Handler, timeout time.Duration) http.Handler {
+	if r, ok := routeAs[TimeoutRoute](route); ok {
+		timeout = r.Timeout()
+	}
+	if timeout <= 0 {
+		return h
+	}
+	return http.TimeoutHandler(h, timeout, "Request timed out\n")
+}
+
+// routeAs 在路由及其被包装的路由中查找实现了 T 的那一个。
+// 装饰器包装路由时会实现 Unwrap() Route，这样 TimeoutRoute 之类的可选接口不会因为包装而丢失。
+func routeAs[T any](route Route) (T, bool) {
+	for {
+		if t, ok := route.(T); ok {
+			return t, true
+		}
+		u, ok := route.(interface{ Unwrap() Route })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		route = u.Unwrap()
+	}
+}
+
+// innermost 返回被所有装饰器包装的原始路由，用于在错误信息中显示处理程序的类型。
+func innermost(route Route) Route {
+	for {
+		u, ok := route.(interface{ Unwrap() Route })
+		if !ok {
+			return route
+		}
+		route = u.Unwrap()
+	}
+}
+
+func AsRoute(f any) any {
+	return fx.Annotate(
+		f,
+		fx.As(new(Route)),
+		fx.ResultTags(`group:"routes"`),
+	)
+}
+
+// AsRouteIf 与 AsRoute 相同，但只在 cond 返回 true 时才把 f 构造的路由加入 "routes" 组。
+// cond 在构建依赖图时用 *Config 求值；返回 false 时 f 不会被调用，但 f 的依赖仍然必须存在。
+// f 必须是返回 Route（以及可选的 error）的构造函数。
+func AsRouteIf(cond func(*Config) bool, f any) any {
+	fv := reflect.ValueOf(f)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumOut() < 1 || ft.NumOut() > 2 || !ft.Out(0).Implements(routeType) ||
+		(ft.NumOut() == 2 && ft.Out(1) != errorType) {
+		err := fmt.Errorf("AsRouteIf: %T is not a Route constructor", f)
+		return fx.Annotate(func() ([]Route, error) { return nil, err }, fx.ResultTags(`group:"routes,flatten"`))
+	}
+
+	// 在 f 的参数之前插入 *Config，用来求值 cond。
+	in := make([]reflect.Type, 0, ft.NumIn()+1)
+	in = append(in, configType)
+	for i := 0; i < ft.NumIn(); i++ {
+		in = append(in, ft.In(i))
+	}
+	out := []reflect.Type{reflect.TypeFor[[]Route](), errorType}
+	fn := reflect.MakeFunc(reflect.FuncOf(in, out, ft.IsVariadic()), func(args []reflect.Value) []reflect.Value {
+		routes, noErr := reflect.Zero(out[0]), reflect.Zero(errorType)
+		if !cond(args[0].Interface().(*Config)) {
+			return []reflect.Value{routes, noErr}
+		}
+		var results []reflect.Value
+		if ft.IsVariadic() {
+			results = fv.CallSlice(args[1:])
+		} else {
+			results = fv.Call(args[1:])
+		}
+		if len(results) == 2 && !results[1].IsNil() {
+			return []reflect.Value{routes, results[1]}
+		}
+		return []reflect.Value{reflect.ValueOf([]Route{results[0].Interface().(Route)}), noErr}
+	})
+	return fx.Annotate(fn.Interface(), fx.ResultTags(`group:"routes,flatten"`))
+}
+
+var (
+	routeType  = reflect.TypeFor[Route]()
+	configType = reflect.TypeFor[*Config]()
+)
+
+// debugEnabled 是 /debug/ 下的路由的开关，见 DebugConfig.Enabled。
+func debugEnabled(cfg *Config) bool {
+	return cfg.Debug.Enabled
+}
+
+// docsEnabled 是 /docs 的开关，见 DocsConfig.Enabled。
+func docsEnabled(cfg *Config) bool {
+	return cfg.Docs.Enabled
+}
+
+// upstreamEnabled 是 /upstream 的开关，见 ClientConfig.UpstreamURL。
+func upstreamEnabled(cfg *Config) bool {
+	return cfg.Client.UpstreamURL != ""
+}
+
+// ReplaceRoutes 用 routes 替换整个 "routes" 组，其余的组件保持不变。
+// 它主要用于测试：把 ReplaceRoutes(stub) 和 appOptions() 一起传给 fx.New，就只会挂载桩路由。
+// 它必须在根模块中使用，见 httpModule。
+func ReplaceRoutes(routes ...Route) fx.Option {
+	return fx.Decorate(
+		fx.Annotate(
+			func([]Route) []Route { return routes },
+			fx.ParamTags(`group:"routes"`),
+			fx.ResultTags(`group:"routes"`),
+		),
+	)
+}
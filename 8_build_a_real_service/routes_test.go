@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+)
+
+// passthrough 是什么也不做的中间件，用来代替 build 依赖的缓存、运维和 CSRF 中间件。
+func passthrough(next http.Handler) http.Handler {
+	return next
+}
+
+// testRouterParams 返回 build 需要的 routerParams，routes 是 "routes" 组中的路由。
+func testRouterParams(t *testing.T, cfg *Config, routes ...Route) routerParams {
+	t.Helper()
+	return routerParams{
+		Routes:   routes,
+		Config:   cfg,
+		Provider: NewRouterProvider(),
+		Cache:    passthrough,
+		Admin:    passthrough,
+		CSRF:     passthrough,
+		Renderer: testRenderer(t),
+		Table:    NewRouteTable(),
+	}
+}
+
+// http.TimeoutHandler 写出响应时会用处理程序设置的响应头覆盖同名的响应头，
+// 外层中间件添加的 Vary 不能因此丢失。
+func TestRouteTimeoutKeepsOuterHeaders(t *testing.T) {
+	cfg := testConfig(t)
+	renderer := testRenderer(t)
+	p := testRouterParams(t, cfg,
+		NewHelloHandler(zap.NewNop(), renderer),
+		NewTimeHandler(zap.NewNop(), NewCodecs(nil), renderer),
+	)
+	mux, err := p.build("main", p.Routes)
+	if err != nil {
+		t.Fatalf("build() error = %v", err)
+	}
+	h := NewCompressionMiddleware(cfg).Wrap(mux)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		acceptEncoding string
+		wantVary       []string
+		wantType       string
+		wantEncoding   string
+	}{
+		{
+			name: "hello gzip", method: http.MethodPost, target: "/hello", acceptEncoding: "gzip",
+			wantVary: []string{"Accept-Language", "Accept-Encoding"}, wantType: "text/plain; charset=utf-8", wantEncoding: "gzip",
+		},
+		{
+			name: "hello identity", method: http.MethodPost, target: "/hello",
+			wantVary: []string{"Accept-Language", "Accept-Encoding"}, wantType: "text/plain; charset=utf-8",
+		},
+		{
+			name: "time gzip", method: http.MethodGet, target: "/time", acceptEncoding: "gzip",
+			wantVary: []string{"Accept", "Accept-Encoding"}, wantType: "application/json", wantEncoding: "gzip",
+		},
+		{
+			name: "time identity", method: http.MethodGet, target: "/time",
+			wantVary: []string{"Accept", "Accept-Encoding"}, wantType: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader("fx"))
+			req = req.WithContext(context.WithValue(req.Context(), languageKey{}, language.English))
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %q", rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Values("Vary"); !slices.Equal(got, tt.wantVary) {
+				t.Errorf("Vary = %q, want %q", got, tt.wantVary)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+		})
+	}
+}
+
+type timeoutRoute struct {
+	Route
+	timeout time.Duration
+}
+
+func (r timeoutRoute) Timeout() time.Duration {
+	return r.timeout
+}
+
+func TestWithTimeout(t *testing.T) {
+	slow := routeFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	tests := []struct {
+		name       string
+		route      Route
+		timeout    time.Duration
+		wantStatus int
+	}{
+		{name: "default timeout", route: slow, timeout: 10 * time.Millisecond, wantStatus: http.StatusServiceUnavailable},
+		{name: "route timeout", route: timeoutRoute{Route: slow, timeout: 10 * time.Millisecond}, timeout: time.Hour, wantStatus: http.StatusServiceUnavailable},
+		{name: "no timeout", route: timeoutRoute{Route: routeFunc("/fast", func(w http.ResponseWriter, r *http.Request) {}), timeout: 0}, timeout: time.Nanosecond, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			withTimeout(tt.route, tt.route, tt.timeout).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// testRoute 是测试用的 Route。
+type testRoute struct {
+	pattern string
+	http.HandlerFunc
+}
+
+func (r testRoute) Pattern() string {
+	return r.pattern
+}
+
+func routeFunc(pattern string, f http.HandlerFunc) Route {
+	return testRoute{pattern: pattern, HandlerFunc: f}
+}
+
+func TestAsRouteIf(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		wantRoutes []string
+	}{
+		{name: "enabled", enabled: true, wantRoutes: []string{"/debug/gc"}},
+		{name: "disabled", enabled: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			var routes []Route
+			app := fxtest.New(t,
+				fx.Supply(&Config{Debug: DebugConfig{Enabled: tt.enabled}}, zap.NewNop()),
+				fx.Provide(AsRouteIf(debugEnabled, func(log *zap.Logger) *GCHandler {
+					called = true
+					return NewGCHandler(log)
+				})),
+				fx.Invoke(fx.Annotate(func(r []Route) { routes = r }, fx.ParamTags(`group:"routes"`))),
+			)
+			app.RequireStart().RequireStop()
+
+			var patterns []string
+			for _, r := range routes {
+				patterns = append(patterns, r.Pattern())
+			}
+			if !slices.Equal(patterns, tt.wantRoutes) {
+				t.Errorf("routes = %q, want %q", patterns, tt.wantRoutes)
+			}
+			if called != tt.enabled {
+				t.Errorf("constructor called = %v, want %v", called, tt.enabled)
+			}
+		})
+	}
+}
+
+func TestAsRouteIfErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name    string
+		f       any
+		wantErr string
+	}{
+		{name: "constructor error", f: func() (*GCHandler, error) { return nil, errBoom }, wantErr: "boom"},
+		{name: "not a constructor", f: 42, wantErr: "not a Route constructor"},
+		{name: "not a route", f: func() string { return "" }, wantErr: "not a Route constructor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fx.New(
+				fx.NopLogger,
+				fx.Supply(&Config{Debug: DebugConfig{Enabled: true}}),
+				fx.Provide(AsRouteIf(debugEnabled, tt.f)),
+				fx.Invoke(fx.Annotate(func([]Route) {}, fx.ParamTags(`group:"routes"`))),
+			)
+			if err := app.Err(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("app.Err() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 默认配置下不注册任何 /debug/ 路由；打开 DebugConfig.Enabled 后全部注册。
+func TestDebugRoutesGated(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		wantDebug bool
+	}{
+		{name: "default", enabled: false, wantDebug: false},
+		{name: "enabled", enabled: true, wantDebug: true},
+	}
+	debugPatterns := []string{
+		"/debug/buildinfo", "/debug/config", "/debug/gc", "/debug/headers", "/debug/logs",
+		"/debug/metrics", "/debug/routes", "/debug/slow", "/debug/stats",
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var table *RouteTable
+			app := fxtest.New(t,
+				appOptions(),
+				fx.NopLogger,
+				fx.Decorate(func(cfg *Config) *Config {
+					cfg.Server.Addr = "127.0.0.1:0"
+					cfg.Log.Level = "error"
+					cfg.Debug.Enabled = tt.enabled
+					return cfg
+				}),
+				fx.Populate(&table),
+			)
+			app.RequireStart()
+			defer app.RequireStop()
+
+			registered := make(map[string]bool)
+			for _, info := range table.Routes() {
+				registered[info.Pattern] = true
+			}
+			for _, pattern := range debugPatterns {
+				if registered[pattern] != tt.wantDebug {
+					t.Errorf("%s registered = %v, want %v", pattern, registered[pattern], tt.wantDebug)
+				}
+			}
+			if !registered["/hello"] {
+				t.Error("/hello is not registered")
+			}
+		})
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		wantStatus int
+	}{
+		{name: "enabled", enabled: true, wantStatus: http.StatusServiceUnavailable},
+		{name: "disabled", enabled: false, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Maintenance: MaintenanceConfig{Enabled: tt.enabled, Message: "back soon"}}
+			mux, err := NewRouter(testRouterParams(t, cfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/anything", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !tt.enabled {
+				return
+			}
+			var resp struct{ Message string }
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Message != "back soon" {
+				t.Errorf("message = %q, want %q", resp.Message, "back soon")
+			}
+		})
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr string
+	}{
+		{pattern: "/echo"},
+		{pattern: "GET /echo/{id}"},
+		{pattern: "example.com/"},
+		{pattern: "POST localhost:8080/upload"},
+		{pattern: "", wantErr: "pattern is empty"},
+		{pattern: "   ", wantErr: "pattern is empty"},
+		{pattern: "GET ", wantErr: "pattern has a method but no path"},
+		{pattern: "echo", wantErr: `path must start with "/"`},
+		{pattern: "GET foo/bar", wantErr: `path must start with "/"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			err := validatePattern(tt.pattern)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validatePattern(%q) = %v, want nil", tt.pattern, err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validatePattern(%q) = %v, want %q", tt.pattern, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewRouterRejectsInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"", "GET foo/bar"} {
+		t.Run(pattern, func(t *testing.T) {
+			_, err := NewRouter(testRouterParams(t, &Config{}, limitedRoute{pattern: pattern}))
+			// 错误中带有路由的类型和出错的模式。
+			if err == nil || !strings.Contains(err.Error(), "main.limitedRoute: invalid pattern "+strconv.Quote(pattern)) {
+				t.Errorf("NewRouter() error = %v, want an invalid pattern error naming main.limitedRoute", err)
+			}
+		})
+	}
+}
+
+// methodRoute 只接受 methods 中的方法。
+type methodRoute struct {
+	pattern string
+	methods []string
+	message string
+}
+
+func (r methodRoute) Pattern() string                            { return r.pattern }
+func (r methodRoute) Methods() []string                          { return r.methods }
+func (r methodRoute) MethodNotAllowedMessage() string            { return r.message }
+func (methodRoute) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+func TestMethodRoute(t *testing.T) {
+	mux, err := NewRouter(testRouterParams(t, &Config{},
+		methodRoute{pattern: "/drain", methods: []string{http.MethodPost}, message: "use POST"},
+		methodRoute{pattern: "/items", methods: []string{"get"}},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, target string
+		wantStatus     int
+		wantAllow      string
+		wantMessage    string
+	}{
+		{method: http.MethodOptions, target: "/drain", wantStatus: http.StatusNoContent, wantAllow: "POST, OPTIONS"},
+		{method: http.MethodPost, target: "/drain", wantStatus: http.StatusOK},
+		{method: http.MethodGet, target: "/drain", wantStatus: http.StatusMethodNotAllowed, wantAllow: "POST, OPTIONS", wantMessage: "use POST"},
+		{method: http.MethodOptions, target: "/items", wantStatus: http.StatusNoContent, wantAllow: "GET, HEAD, OPTIONS"},
+		{method: http.MethodHead, target: "/items", wantStatus: http.StatusOK},
+		{method: http.MethodDelete, target: "/items", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, HEAD, OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if tt.wantMessage != "" && !strings.Contains(rec.Body.String(), tt.wantMessage) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body, tt.wantMessage)
+			}
+		})
+	}
+}
+
+// multiPatternRoute 在 patterns 的每个模式上注册，响应体是请求的路径。
+type multiPatternRoute struct {
+	patterns []string
+}
+
+func (multiPatternRoute) Pattern() string      { return "/unused" }
+func (r multiPatternRoute) Patterns() []string { return r.patterns }
+func (multiPatternRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, r.URL.Path)
+}
+
+func TestMultiPatternRoute(t *testing.T) {
+	p := testRouterParams(t, &Config{}, multiPatternRoute{patterns: []string{"GET /{$}", "GET /index.html"}})
+	mux, err := NewRouter(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{"/", "/index.html"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != target {
+			t.Errorf("GET %s = %d %q, want 200 %q", target, rec.Code, rec.Body, target)
+		}
+	}
+	// Pattern 不再注册。
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unused", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /unused = %d, want 404", rec.Code)
+	}
+	var patterns []string
+	for _, info := range p.Table.Routes() {
+		patterns = append(patterns, info.Pattern)
+	}
+	if want := []string{"GET /index.html", "GET /{$}"}; !slices.Equal(patterns, want) {
+		t.Errorf("route table = %q, want %q", patterns, want)
+	}
+}
+
+func TestMultiPatternRouteDuplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []Route
+	}{
+		{name: "same route", routes: []Route{multiPatternRoute{patterns: []string{"/a", "/b", "/a"}}}},
+		{name: "other route", routes: []Route{multiPatternRoute{patterns: []string{"/a", "/b"}}, routeFunc("/b", nil)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRouter(testRouterParams(t, &Config{}, tt.routes...))
+			if err == nil || !strings.Contains(err.Error(), "is registered by both") {
+				t.Errorf("NewRouter() error = %v, want a duplicate pattern error", err)
+			}
+		})
+	}
+}
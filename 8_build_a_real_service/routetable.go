@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// RouteInfo 描述一个已注册的模式。
+type RouteInfo struct {
+	// Router 是模式所在的路由器："main"、"admin"，或者虚拟主机的 "vhost:<路由组>"。
+	Router  string   `json:"router"`
+	Pattern string   `json:"pattern"`
+	Handler string   `json:"handler"`
+	Methods []string `json:"methods,omitempty"`
+	Admin   bool     `json:"admin,omitempty"`
+}
+
+// RouteTable 记录路由器注册过的全部模式。"routes" 组中路由的顺序取决于 Fx 的实现，每次运行都可能不同，
+// 所以 build 先按模式排序再注册，RouteTable 返回的列表也总是排好序的：/debug/routes 的输出是确定的，
+// 模式冲突时的错误信息也是。
+type RouteTable struct {
+	mu     sync.Mutex
+	routes []RouteInfo
+}
+
+func NewRouteTable() *RouteTable {
+	return &RouteTable{}
+}
+
+func (t *RouteTable) add(info RouteInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = append(t.routes, info)
+}
+
+// Routes 返回按路由器和模式排序的全部模式。
+func (t *RouteTable) Routes() []RouteInfo {
+	t.mu.Lock()
+	routes := append([]RouteInfo(nil), t.routes...)
+	t.mu.Unlock()
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Router != routes[j].Router {
+			return routes[i].Router < routes[j].Router
+		}
+		return routes[i].Pattern < routes[j].Pattern
+	})
+	return routes
+}
+
+// routeInfo 返回 route 在 pattern 上注册时的描述。
+func routeInfo(router, pattern string, route Route) RouteInfo {
+	info := RouteInfo{
+		Router:  router,
+		Pattern: pattern,
+		Handler: fmt.Sprintf("%T", innermost(route)),
+		Admin:   isAdminRoute(route),
+	}
+	if r, ok := routeAs[MethodRoute](route); ok {
+		info.Methods = r.Methods()
+	}
+	return info
+}
+
+// RoutesHandler 在 /debug/routes 以 JSON 格式列出所有已注册的模式，用于排查路由问题。
+type RoutesHandler struct {
+	log   *zap.Logger
+	table *RouteTable
+}
+
+func NewRoutesHandler(log *zap.Logger, table *RouteTable) *RoutesHandler {
+	return &RoutesHandler{log: log, table: table}
+}
+
+func (*RoutesHandler) Pattern() string {
+	return "/debug/routes"
+}
+
+func (*RoutesHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+func (h *RoutesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := writeJSON(w, http.StatusOK, h.table.Routes(), true); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	stdlog "log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/net/netutil"
+)
+
+// NewHTTPServer 提供公共服务器；配置了 AdminConfig.Addr 时，它还负责运维服务器的启动和停止。
+// 两个服务器在同一个 OnStart 钩子中先后绑定端口，任何一个绑定失败时已经打开的监听器都会被关闭，
+// 然后才开始处理请求，所以不会出现只有一个服务器在运行的情况。服务器开始处理请求之后，先执行 CacheWarmup，再变为就绪。
+func NewHTTPServer(lc fx.Lifecycle, handler http.Handler, adminHandler AdminHandler, log *zap.Logger, cfg *Config, probe *ReadinessProbe, drainer *Drainer, streams *StreamRegistry, tracker *DrainTracker, warmup *CacheWarmup, startup *StartupSignal) *http.Server {
+	// 所有请求的 context 都派生自 base，关闭时超过 DrainTimeout 仍未完成的请求通过它被取消。
+	base, cancelBase := context.WithCancelCause(context.Background())
+	baseContext := func(net.Listener) context.Context { return base }
+	srv := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      handler,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		ErrorLog:     serverErrorLog(log, "public"),
+		BaseContext:  baseContext,
+	}
+	drainer.track(srv)
+	// Validate 已经校验过级别。
+	level, _ := zapcore.ParseLevel(cfg.Server.LifecycleLogLevel)
+	var adminSrv *http.Server
+	if adminHandler.Handler != nil {
+		adminSrv = &http.Server{
+			Addr:         cfg.Admin.Addr,
+			Handler:      adminHandler,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			ErrorLog:     serverErrorLog(log, "admin"),
+			BaseContext:  baseContext,
+		}
+	}
+	lc.Append(Interruptible(startup, WithHookTimeout(log, cfg, "http server", fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			ln, err := listenWithRetry(ctx, cfg.Server, log)
+			if err != nil {
+				return err
+			}
+			var adminLn net.Listener
+			if adminSrv != nil {
+				adminLn, err = listenWithRetry(ctx, adminListenConfig(cfg), log)
+				if err != nil {
+					// 这个钩子失败时 Fx 不会调用它的 OnStop，所以在这里关闭已经打开的监听器。
+					if closeErr := ln.Close(); closeErr != nil {
+						log.Warn("Failed to close listener", zap.Error(closeErr))
+					}
+					return fmt.Errorf("admin server: %w", err)
+				}
+			}
+
+			if n := cfg.Server.MaxConnections; n > 0 {
+				ln = netutil.LimitListener(ln, n)
+			}
+			log.Log(level, "Starting HTTP server", zap.String("network", ln.Addr().Network()), zap.String("addr", srv.Addr))
+			go srv.Serve(ln)
+			if adminSrv != nil {
+				log.Log(level, "Starting admin server", zap.String("addr", adminSrv.Addr))
+				go adminSrv.Serve(adminLn)
+			}
+			if err := warmup.Run(ctx); err != nil {
+				// 同样，钩子失败时不会调用 OnStop，已经启动的服务器要在这里关闭。
+				err = errors.Join(err, srv.Close())
+				if adminSrv != nil {
+					err = errors.Join(err, adminSrv.Close())
+				}
+				return err
+			}
+			probe.SetReady(true)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			start := time.Now()
+			inFlight := tracker.BeginDrain()
+			probe.SetReady(false)
+			// 先取消长连接，否则 Shutdown 会一直等它们变为空闲。
+			if n := streams.CloseAll(); n > 0 {
+				log.Log(level, "Closed long-lived connections", zap.Int("count", n))
+			}
+			if d := cfg.Server.DrainTimeout; d > 0 {
+				timer := time.AfterFunc(d, func() {
+					log.Warn("Drain timeout exceeded, cancelling in-flight requests",
+						zap.Duration("drain_timeout", d),
+						zap.Int64("in_flight", tracker.InFlight()),
+					)
+					cancelBase(errDrainTimeout)
+				})
+				defer timer.Stop()
+			}
+			defer cancelBase(errShuttingDown)
+			err := srv.Shutdown(ctx)
+			if adminSrv != nil {
+				err = errors.Join(err, adminSrv.Shutdown(ctx))
+			}
+			stopLevel := level
+			if err != nil {
+				// 关闭出错时至少以 warn 级别记录。
+				stopLevel = max(level, zapcore.WarnLevel)
+			}
+			log.Log(stopLevel, "HTTP server stopped",
+				zap.Duration("duration", time.Since(start)),
+				zap.Int64("in_flight_at_shutdown", inFlight),
+				zap.Int64("drained", tracker.Drained()),
+				zap.Int64("abandoned", tracker.InFlight()),
+				zap.Error(err),
+			)
+			if cfg.Server.Network == "unix" {
+				if rmErr := os.Remove(cfg.Server.Addr); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) {
+					err = errors.Join(err, rmErr)
+				}
+			}
+			return err
+		},
+	})))
+	return srv
+}
+
+// adminListenConfig 返回运维服务器的监听配置：它总是监听 TCP 地址 AdminConfig.Addr，
+// 重试和 keep-alive 与公共服务器相同，但不使用 SO_REUSEPORT 和自定义的监听队列长度。
+func adminListenConfig(cfg *Config) ServerConfig {
+	sc := cfg.Server
+	sc.Network = "tcp"
+	sc.Addr = cfg.Admin.Addr
+	sc.ReusePort = false
+	sc.Backlog = 0
+	return sc
+}
+
+// serverErrorLog 把 net/http 内部的错误（TLS 握手失败、连接读写错误等）以 warn 级别写入 zap，
+// 而不是 Go 默认的标准错误输出。
+func serverErrorLog(log *zap.Logger, server string) *stdlog.Logger {
+	l, err := zap.NewStdLogAt(log.With(zap.String("server", server)), zapcore.WarnLevel)
+	if err != nil {
+		// 只有级别无效时才会出错，这里的级别是常量。
+		panic(err)
+	}
+	return l
+}
+
+// listenWithRetry 在监听失败时按 ListenAttempts 和 ListenBackoff 重试，每次失败都记录日志。
+// ctx 是 OnStart 的 context，启动超时后不再重试。
+func listenWithRetry(ctx context.Context, cfg ServerConfig, log *zap.Logger) (net.Listener, error) {
+	backoff := cfg.ListenBackoff
+	for attempt := 1; ; attempt++ {
+		ln, err := listen(ctx, cfg)
+		if err == nil || attempt >= cfg.ListenAttempts {
+			return ln, err
+		}
+		log.Warn("Failed to listen, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", cfg.ListenAttempts),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, errors.Join(err, ctx.Err())
+		}
+		backoff *= 2
+	}
+}
+
+// listen 按 ServerConfig.Network 监听 TCP 地址或 Unix 套接字路径。
+// 接受的 TCP 连接按 ServerConfig.KeepAlive 发送 keep-alive 探测，ReusePort 和 Backlog 也只作用于 TCP。
+func listen(ctx context.Context, cfg ServerConfig) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAliveConfig: cfg.KeepAlive}
+	switch cfg.Network {
+	case "", "tcp":
+		if cfg.ReusePort {
+			lc.Control = reusePortControl
+		}
+		ln, err := lc.Listen(ctx, "tcp", cfg.Addr)
+		if err != nil || cfg.Backlog <= 0 {
+			return ln, err
+		}
+		if err := setBacklog(ln, cfg.Backlog); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("set listen backlog: %w", err)
+		}
+		return ln, nil
+	case "unix":
+		if err := removeStaleSocket(cfg.Addr); err != nil {
+			return nil, err
+		}
+		return lc.Listen(ctx, "unix", cfg.Addr)
+	default:
+		return nil, fmt.Errorf("unsupported network %q", cfg.Network)
+	}
+}
+
+// removeStaleSocket 删除上次运行遗留的套接字文件，否则 net.Listen 会报告地址已被占用。
+// 路径上是普通文件时不删除，而是交给 net.Listen 报错。
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return nil
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serverTimings 收集处理程序通过 AddServerTiming 报告的耗时。
+type serverTimings struct {
+	mu      sync.Mutex
+	metrics []serverTiming
+}
+
+type serverTiming struct {
+	name string
+	dur  time.Duration
+}
+
+type serverTimingKey struct{}
+
+// AddServerTiming 为当前请求的 Server-Timing 响应头添加一项耗时，例如 AddServerTiming(ctx, "db", d)。
+// 只有在响应头写出之前添加的项才会出现；没有启用 ServerTimingMiddleware 时它什么都不做。
+func AddServerTiming(ctx context.Context, name string, d time.Duration) {
+	t, ok := ctx.Value(serverTimingKey{}).(*serverTimings)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics = append(t.metrics, serverTiming{name: name, dur: d})
+}
+
+// NewServerTimingMiddleware 在 DebugConfig.ServerTiming 打开时输出 Server-Timing 响应头，供浏览器的开发者工具显示。
+// app 是从请求到达到响应头写出的时间，之后是处理程序添加的各项耗时。
+// Server-Timing 会暴露内部的耗时，所以默认关闭。
+func NewServerTimingMiddleware(cfg *Config) Middleware {
+	return func(next http.Handler) http.Handler {
+		if !cfg.Debug.ServerTiming {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timings := &serverTimings{}
+			tw := &timingWriter{ResponseWriter: w, start: time.Now(), timings: timings}
+			next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), serverTimingKey{}, timings)))
+			tw.writeHeader()
+		})
+	}
+}
+
+// timingWriter 在响应头写出之前加上 Server-Timing。
+type timingWriter struct {
+	http.ResponseWriter
+	start       time.Time
+	timings     *serverTimings
+	wroteHeader bool
+}
+
+func (w *timingWriter) writeHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	parts := []string{formatServerTiming("app", time.Since(w.start))}
+	w.timings.mu.Lock()
+	for _, m := range w.timings.metrics {
+		parts = append(parts, formatServerTiming(m.name, m.dur))
+	}
+	w.timings.mu.Unlock()
+	w.Header().Set("Server-Timing", strings.Join(parts, ", "))
+}
+
+// formatServerTiming 按规范输出一项耗时，单位是毫秒，例如 "app;dur=12.3"。
+func formatServerTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.1f", name, float64(d)/float64(time.Millisecond))
+}
+
+func (w *timingWriter) WriteHeader(status int) {
+	// 1xx 是中间响应，真正的响应头还没有写出。
+	if status >= 200 {
+		w.writeHeader()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	w.writeHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timingWriter) Flush() {
+	w.writeHeader()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *timingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
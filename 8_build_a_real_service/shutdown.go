@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"go.uber.org/fx"
+)
+
+// ShutdownContext 在应用程序开始停止时被取消。处理程序可以 select 它的 Done()，
+// 在关闭过程中拒绝新的长时间操作。
+type ShutdownContext context.Context
+
+// errShuttingDown 是 ShutdownContext 被取消的原因。
+var errShuttingDown = errors.New("application is shutting down")
+
+// errDrainTimeout 是超过 ServerConfig.DrainTimeout 时请求的 context 被取消的原因。
+var errDrainTimeout = errors.New("drain timeout exceeded")
+
+// shutdownSignal 持有 ShutdownContext 及其取消函数。
+type shutdownSignal struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+func newShutdownSignal() *shutdownSignal {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &shutdownSignal{ctx: ctx, cancel: cancel}
+}
+
+func NewShutdownContext(s *shutdownSignal) ShutdownContext {
+	return s.ctx
+}
+
+// cancelOnStop 注册取消 ShutdownContext 的 OnStop 钩子。
+// OnStop 钩子按注册的相反顺序执行，而 ShutdownContext 可能在服务器之前就被构造出来；
+// 所以取消操作由 appOptions 最后一个 fx.Invoke 单独注册，保证它在其他 OnStop 钩子之前执行。
+func cancelOnStop(lc fx.Lifecycle, s *shutdownSignal) {
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			s.cancel(errShuttingDown)
+			return nil
+		},
+	})
+}
+
+// DrainTracker 统计正在处理的请求数。关闭开始后，每完成一个请求就记为一个被排空的请求，
+// 服务器据此在关闭完成时输出汇总日志。
+type DrainTracker struct {
+	inFlight atomic.Int64
+	draining atomic.Bool
+	drained  atomic.Int64
+}
+
+func NewDrainTracker() *DrainTracker {
+	return &DrainTracker{}
+}
+
+// Middleware 返回统计请求的中间件，它应该位于中间件链的外层。
+func (t *DrainTracker) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.inFlight.Add(1)
+			defer func() {
+				t.inFlight.Add(-1)
+				if t.draining.Load() {
+					t.drained.Add(1)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BeginDrain 标记关闭开始，并返回此刻正在处理的请求数。
+func (t *DrainTracker) BeginDrain() int64 {
+	t.draining.Store(true)
+	return t.inFlight.Load()
+}
+
+// Drained 返回关闭开始后完成的请求数。
+func (t *DrainTracker) Drained() int64 {
+	return t.drained.Load()
+}
+
+// InFlight 返回仍在处理的请求数。
+func (t *DrainTracker) InFlight() int64 {
+	return t.inFlight.Load()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SlowRequest 是一个超过阈值的请求的记录。
+type SlowRequest struct {
+	Time      time.Time     `json:"time"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Route     string        `json:"route"`
+	Status    int           `json:"status"`
+	Duration  time.Duration `json:"duration_ns"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// SlowRequestLog 是一个环形缓冲区，保存最近的 SlowRequestsConfig.Samples 个慢请求。
+// 慢请求由 DecorateRoutesWithMetrics 和 DecorateVHostRoutesWithMetrics 包装的路由通过 Observe 记录，
+// 所以主路由器、管理路由器和虚拟主机的路由器处理的请求都会被记录，路由的模式取自处理请求的路由器设置的 r.Pattern。
+// 没有匹配路由的请求（404、405 和尾部斜杠的重定向）不会被记录，耗时也不包括路由之外的中间件。
+type SlowRequestLog struct {
+	log       *zap.Logger
+	threshold time.Duration
+
+	mu      sync.Mutex
+	samples []SlowRequest
+	next    int
+	full    bool
+}
+
+func NewSlowRequestLog(cfg *Config, log *zap.Logger) *SlowRequestLog {
+	return &SlowRequestLog{
+		log:       log,
+		threshold: cfg.SlowRequests.Threshold,
+		samples:   make([]SlowRequest, cfg.SlowRequests.Samples),
+	}
+}
+
+// Observe 在 d 超过 SlowRequestsConfig.Threshold 时以 warn 级别记录请求，并把它保存到缓冲区。阈值为 0 时什么也不做。
+func (l *SlowRequestLog) Observe(r *http.Request, route string, status int, start time.Time, d time.Duration) {
+	if l.threshold <= 0 || d < l.threshold {
+		return
+	}
+	req := SlowRequest{
+		Time:      start,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Route:     route,
+		Status:    status,
+		Duration:  d,
+		RequestID: RequestIDFromContext(r.Context()),
+	}
+	l.Record(req)
+	loggerFrom(r.Context(), l.log).Warn("Slow request",
+		zap.String("method", req.Method),
+		zap.String("path", req.Path),
+		zap.String("route", req.Route),
+		zap.Int("status", req.Status),
+		zap.Duration("duration", req.Duration),
+	)
+}
+
+// Record 保存一个慢请求，缓冲区满时覆盖最早的记录。
+func (l *SlowRequestLog) Record(req SlowRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.samples) == 0 {
+		return
+	}
+	l.samples[l.next] = req
+	l.next = (l.next + 1) % len(l.samples)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Slowest 返回缓冲区中的记录，按耗时从长到短排序。
+func (l *SlowRequestLog) Slowest() []SlowRequest {
+	l.mu.Lock()
+	n := l.next
+	if l.full {
+		n = len(l.samples)
+	}
+	out := make([]SlowRequest, n)
+	copy(out, l.samples[:n])
+	l.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Duration > out[j].Duration })
+	return out
+}
+
+// SlowHandler 以 JSON 格式返回最近的慢请求，耗时最长的在前。
+type SlowHandler struct {
+	log  *zap.Logger
+	slow *SlowRequestLog
+}
+
+func NewSlowHandler(log *zap.Logger, slow *SlowRequestLog) *SlowHandler {
+	return &SlowHandler{log: log, slow: slow}
+}
+
+func (*SlowHandler) Pattern() string {
+	return "/debug/slow"
+}
+
+func (h *SlowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := WriteJSON(w, http.StatusOK, h.slow.Slowest()); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Inasayang/fxdemo/8_build_a_real_service/internal/logtest"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func testSlowRequestLog(t *testing.T, threshold time.Duration, samples int) *SlowRequestLog {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.SlowRequests.Threshold = threshold
+	cfg.SlowRequests.Samples = samples
+	return NewSlowRequestLog(cfg, zap.NewNop())
+}
+
+func slowDurations(reqs []SlowRequest) []time.Duration {
+	out := make([]time.Duration, len(reqs))
+	for i, req := range reqs {
+		out[i] = req.Duration
+	}
+	return out
+}
+
+func TestSlowRequestLogRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples int
+		record  []time.Duration
+		want    []time.Duration
+	}{
+		{name: "empty", samples: 3, record: nil, want: []time.Duration{}},
+		{name: "partial", samples: 3, record: []time.Duration{1, 3}, want: []time.Duration{3, 1}},
+		{name: "full", samples: 3, record: []time.Duration{2, 1, 3}, want: []time.Duration{3, 2, 1}},
+		{name: "wraparound", samples: 3, record: []time.Duration{9, 1, 2, 3, 4}, want: []time.Duration{4, 3, 2}},
+		{name: "wraparound twice", samples: 2, record: []time.Duration{5, 6, 7, 1, 2}, want: []time.Duration{2, 1}},
+		{name: "no samples", samples: 0, record: []time.Duration{1}, want: []time.Duration{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := testSlowRequestLog(t, time.Second, tt.samples)
+			for _, d := range tt.record {
+				l.Record(SlowRequest{Duration: d})
+			}
+			if got := slowDurations(l.Slowest()); !slices.Equal(got, tt.want) {
+				t.Errorf("Slowest() durations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlowRequestLogObserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		d         time.Duration
+		want      bool
+	}{
+		{name: "disabled", threshold: 0, d: time.Hour, want: false},
+		{name: "below threshold", threshold: time.Second, d: time.Second - 1, want: false},
+		{name: "at threshold", threshold: time.Second, d: time.Second, want: true},
+		{name: "above threshold", threshold: time.Second, d: 2 * time.Second, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, logs := logtest.NewObservedLogger()
+			cfg := testConfig(t)
+			cfg.SlowRequests.Threshold = tt.threshold
+			l := NewSlowRequestLog(cfg, log)
+
+			r := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+			l.Observe(r, "/items/{id}", http.StatusOK, time.Now(), tt.d)
+
+			got := l.Slowest()
+			if (len(got) == 1) != tt.want {
+				t.Fatalf("Slowest() = %v, want recorded %v", got, tt.want)
+			}
+			if n := logs.FilterMessage("Slow request").Len(); (n == 1) != tt.want {
+				t.Errorf("logged %d slow requests, want recorded %v", n, tt.want)
+			}
+			if tt.want && (got[0].Route != "/items/{id}" || got[0].Path != "/items/42") {
+				t.Errorf("Slowest()[0] = %+v, want route /items/{id} and path /items/42", got[0])
+			}
+		})
+	}
+}
+
+// 慢请求的路由取自处理请求的路由器，包括管理路由器和虚拟主机的路由器。
+func TestSlowRequestsRecordServingRouter(t *testing.T) {
+	var (
+		handler http.Handler
+		admin   AdminHandler
+		slow    *SlowRequestLog
+	)
+	app := fxtest.New(t,
+		appOptions(),
+		fx.NopLogger,
+		AsVHostRoute("api", func() Route {
+			return routeFunc("/v1/items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+		}),
+		fx.Decorate(func(cfg *Config) *Config {
+			cfg.Server.Addr = "127.0.0.1:0"
+			cfg.Admin.Addr = "127.0.0.1:0"
+			cfg.Log.Level = "error"
+			cfg.VHost.Hosts = map[string]string{"api.example.com": "api"}
+			cfg.SlowRequests.Threshold = time.Nanosecond
+			return cfg
+		}),
+		fx.Populate(&handler, &admin, &slow),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		host    string
+		target  string
+		want    string
+	}{
+		{name: "main", handler: handler, method: http.MethodGet, host: "example.com", target: "/health", want: "/health"},
+		{name: "vhost", handler: handler, method: http.MethodGet, host: "api.example.com", target: "/v1/items/7", want: "/v1/items/{id}"},
+		{name: "admin", handler: admin, method: http.MethodPost, host: "localhost", target: "/admin/undrain", want: "/admin/undrain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Host = tt.host
+			r.RemoteAddr = "127.0.0.1:1234"
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, r)
+			if rec.Code >= 400 {
+				t.Fatalf("status = %d, want success; body %q", rec.Code, rec.Body)
+			}
+
+			found := false
+			for _, req := range slow.Slowest() {
+				if req.Path == r.URL.Path {
+					found = true
+					if req.Route != tt.want {
+						t.Errorf("Route = %q, want %q", req.Route, tt.want)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("no slow request recorded for %s", r.URL.Path)
+			}
+		})
+	}
+}
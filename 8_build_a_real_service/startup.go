@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/fx"
+)
+
+// errStartupInterrupted 是启动过程中收到 SIGINT 或 SIGTERM 时 OnStart 钩子返回的错误。
+var errStartupInterrupted = errors.New("startup interrupted")
+
+// StartupSignal 在收到 SIGINT 或 SIGTERM 时被取消。fx.App.Run 在启动完成之后才处理信号，
+// 卡在慢的 OnStart 钩子上时，信号只能等到启动结束或超时；用 Interruptible 包装的钩子则会立即中止。
+type StartupSignal struct {
+	ctx context.Context
+}
+
+func NewStartupSignal(lc fx.Lifecycle) *StartupSignal {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			cancel(fmt.Errorf("%w: received %v", errStartupInterrupted, sig))
+		case <-done:
+		}
+	}()
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			close(done)
+			return nil
+		},
+	})
+	return &StartupSignal{ctx: ctx}
+}
+
+// Interruptible 让钩子的 OnStart 在收到信号时中止：信号到达之前还没有执行的钩子直接返回错误，
+// 正在执行的钩子的 context 被取消。OnStart 返回错误后，Fx 会停止已经启动的组件，不会留下启动了一半的应用程序。
+// Fx 回滚时使用的是它自己的 context，所以不能直接取消传给 fx.App.Start 的 context：那样回滚会被跳过。
+func Interruptible(startup *StartupSignal, hook fx.Hook) fx.Hook {
+	start := hook.OnStart
+	if start == nil {
+		return hook
+	}
+	hook.OnStart = func(ctx context.Context) error {
+		if err := context.Cause(startup.ctx); err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		stop := context.AfterFunc(startup.ctx, func() {
+			cancel(context.Cause(startup.ctx))
+		})
+		defer stop()
+		err := start(ctx)
+		if cause := context.Cause(startup.ctx); err != nil && cause != nil {
+			return fmt.Errorf("%w (%w)", cause, err)
+		}
+		return err
+	}
+	return hook
+}
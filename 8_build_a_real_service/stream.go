@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// StreamRegistry 跟踪长时间运行的连接（流式响应、WebSocket 等）。
+// srv.Shutdown 会一直等待连接空闲，而这类连接永远不会空闲，
+// 所以服务器在 OnStop 中先通过 CloseAll 取消它们的 context，再调用 Shutdown。
+type StreamRegistry struct {
+	mu      sync.Mutex
+	closed  bool
+	next    int
+	cancels map[int]context.CancelFunc
+}
+
+func NewStreamRegistry() *StreamRegistry {
+	return &StreamRegistry{cancels: make(map[int]context.CancelFunc)}
+}
+
+// Track 登记一个长连接。返回的 context 在父 context 结束或服务器开始关闭时被取消；
+// 处理程序返回前必须调用 release。
+func (sr *StreamRegistry) Track(parent context.Context) (ctx context.Context, release func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.closed {
+		cancel()
+		return ctx, func() {}
+	}
+	id := sr.next
+	sr.next++
+	sr.cancels[id] = cancel
+
+	return ctx, func() {
+		sr.mu.Lock()
+		delete(sr.cancels, id)
+		sr.mu.Unlock()
+		cancel()
+	}
+}
+
+// CloseAll 取消所有已登记的长连接，并拒绝之后的登记。它返回被取消的连接数。
+func (sr *StreamRegistry) CloseAll() int {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.closed = true
+	n := len(sr.cancels)
+	for id, cancel := range sr.cancels {
+		cancel()
+		delete(sr.cancels, id)
+	}
+	return n
+}
+
+// StreamHandler 每秒输出一行，直到客户端断开、服务器关闭或者输出了 count 查询参数指定的行数。
+// 它演示了长连接如何配合 StreamRegistry，以及如何使用 HTTP trailer：响应结束后，
+// X-Stream-Ticks 给出输出的行数，X-Content-Sha256 给出响应体（压缩前）的 SHA-256，客户端可以用它校验完整性。
+// ShutdownContext 被取消后，新的请求得到 503，而不是开始一个马上就会被关闭的流。
+type StreamHandler struct {
+	log      *zap.Logger
+	streams  *StreamRegistry
+	shutdown ShutdownContext
+	renderer *ErrorRenderer
+}
+
+func NewStreamHandler(log *zap.Logger, streams *StreamRegistry, shutdown ShutdownContext, renderer *ErrorRenderer) *StreamHandler {
+	return &StreamHandler{log: log, streams: streams, shutdown: shutdown, renderer: renderer}
+}
+
+func (*StreamHandler) Pattern() string {
+	return "/stream"
+}
+
+// 流式响应不能被 http.TimeoutHandler 缓冲，所以不设超时。
+func (*StreamHandler) Timeout() time.Duration {
+	return 0
+}
+
+// streamTrailers 是 /stream 在响应结束后发送的 trailer。
+var streamTrailers = []string{"X-Stream-Ticks", "X-Content-Sha256"}
+
+func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	count := 0
+	if s := r.URL.Query().Get("count"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			h.renderer.Render(w, r, http.StatusBadRequest, "count must be a positive integer")
+			return
+		}
+		count = n
+	}
+	if h.shutdown.Err() != nil {
+		h.renderer.Render(w, r, http.StatusServiceUnavailable, "shutting down")
+		return
+	}
+
+	ctx, release := h.streams.Track(r.Context())
+	defer release()
+	log := loggerFrom(ctx, h.log)
+
+	rc := http.NewResponseController(w)
+	// 流式响应不受 ServerConfig.WriteTimeout 限制。
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn("Failed to clear write deadline", zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	// trailer 必须在写出响应头之前声明，值在处理程序返回前设置。
+	w.Header().Set("Trailer", strings.Join(streamTrailers, ", "))
+	sum := sha256.New()
+	ticks := 0
+	defer func() {
+		w.Header().Set("X-Stream-Ticks", strconv.Itoa(ticks))
+		w.Header().Set("X-Content-Sha256", hex.EncodeToString(sum.Sum(nil)))
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for i := 1; ; i++ {
+		if _, err := fmt.Fprintf(io.MultiWriter(w, sum), "tick %d\n", i); err != nil {
+			log.Warn("Failed to write stream", zap.Error(err))
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			log.Warn("Failed to flush stream", zap.Error(err))
+			return
+		}
+		ticks = i
+		if i == count {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			log.Info("Stream closed", zap.Int("ticks", i), zap.Error(context.Cause(ctx)))
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// ShutdownContext 被取消后，/stream 不再开始新的流。
+func TestStreamHandlerShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		shutdown bool
+		want     int
+		wantBody string
+	}{
+		{name: "running", shutdown: false, want: http.StatusOK, wantBody: "tick 1\n"},
+		{name: "shutting down", shutdown: true, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newShutdownSignal()
+			if tt.shutdown {
+				s.cancel(errShuttingDown)
+			}
+			h := NewStreamHandler(zap.NewNop(), NewStreamRegistry(), NewShutdownContext(s), testRenderer(t))
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream?count=1", nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestShutdownContextCancelledOnStop(t *testing.T) {
+	var ctx ShutdownContext
+	app := fxtest.New(t,
+		fx.Provide(newShutdownSignal, NewShutdownContext),
+		fx.Invoke(cancelOnStop),
+		fx.Populate(&ctx),
+	)
+	app.RequireStart()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("ShutdownContext cancelled before stop: %v", err)
+	}
+	app.RequireStop()
+	if err := context.Cause(ctx); !errors.Is(err, errShuttingDown) {
+		t.Errorf("context.Cause(ShutdownContext) = %v, want %v", err, errShuttingDown)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+//go:embed static/swagger.html static/echo_form.html
+var staticFiles embed.FS
+
+// swaggerTemplate 是 Swagger UI 的页面。页面本身嵌入在二进制文件中，Swagger UI 的脚本和样式从 CDN 加载。
+var swaggerTemplate = template.Must(template.ParseFS(staticFiles, "static/swagger.html"))
+
+// SwaggerHandler 在 /docs 提供 Swagger UI，展示 DocsConfig.SpecURL 指向的 OpenAPI 文档。
+// 只有开启了 DocsConfig.Enabled 才会注册，见 docsEnabled。
+type SwaggerHandler struct {
+	log  *zap.Logger
+	page []byte
+}
+
+// NewSwaggerHandler 在启动时渲染页面，之后每个请求都返回同样的内容。
+func NewSwaggerHandler(log *zap.Logger, cfg *Config) (*SwaggerHandler, error) {
+	var buf bytes.Buffer
+	if err := swaggerTemplate.Execute(&buf, struct{ SpecURL string }{cfg.Docs.SpecURL}); err != nil {
+		return nil, err
+	}
+	return &SwaggerHandler{log: log, page: buf.Bytes()}, nil
+}
+
+func (*SwaggerHandler) Pattern() string {
+	return "/docs"
+}
+
+func (h *SwaggerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(h.page); err != nil {
+		h.log.Error("Failed to write response", zap.Error(err))
+	}
+}
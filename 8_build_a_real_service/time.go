@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"time"
+	// 内置时区数据库，?tz= 的校验不依赖于主机上是否安装了 tzdata。
+	_ "time/tzdata"
+
+	"go.uber.org/zap"
+)
+
+// TimeHandler 在 /time 返回服务器的当前时间（RFC3339），?tz= 指定 IANA 时区，默认为 UTC。
+// 它几乎没有依赖，适合用作集成测试的目标。响应的格式由 Codecs 按 Accept 协商。
+type TimeHandler struct {
+	handler http.Handler
+	codecs  *Codecs
+}
+
+func NewTimeHandler(log *zap.Logger, codecs *Codecs, renderer *ErrorRenderer) *TimeHandler {
+	h := &TimeHandler{codecs: codecs}
+	h.handler = HandleErrors(log, renderer, h.serve)
+	return h
+}
+
+func (*TimeHandler) Pattern() string {
+	return "/time"
+}
+
+func (*TimeHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+func (h *TimeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+type serverTime struct {
+	Time     string `json:"time"`
+	Timezone string `json:"timezone"`
+}
+
+func (h *TimeHandler) serve(w http.ResponseWriter, r *http.Request) *HTTPError {
+	loc := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		// "Local" 是服务器所在的时区，不是 IANA 时区名，不对外暴露。
+		l, err := time.LoadLocation(tz)
+		if err != nil || tz == "Local" {
+			return &HTTPError{
+				Status:  http.StatusBadRequest,
+				Code:    "invalid_timezone",
+				Message: "tz must be an IANA time zone name, such as Asia/Shanghai",
+				Err:     err,
+			}
+		}
+		loc = l
+	}
+
+	resp := serverTime{Time: time.Now().In(loc).Format(time.RFC3339), Timezone: loc.String()}
+	if err := h.codecs.Write(w, r, http.StatusOK, resp); err != nil {
+		return &HTTPError{
+			Status:  http.StatusInternalServerError,
+			Code:    "write_failed",
+			Message: "Failed to write response",
+			Err:     err,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestTimeHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantZone   string
+		wantOffset int
+	}{
+		{name: "default UTC", wantStatus: http.StatusOK, wantZone: "UTC"},
+		{name: "valid tz", query: "?tz=Asia/Shanghai", wantStatus: http.StatusOK, wantZone: "Asia/Shanghai", wantOffset: 8 * 3600},
+		{name: "invalid tz", query: "?tz=Mars/Olympus", wantStatus: http.StatusBadRequest},
+		{name: "Local rejected", query: "?tz=Local", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewTimeHandler(zap.NewNop(), NewCodecs(nil), testRenderer(t)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/time"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %q", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				var resp struct{ Code string }
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Code != "invalid_timezone" {
+					t.Errorf("code = %q, want invalid_timezone", resp.Code)
+				}
+				return
+			}
+			var resp serverTime
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Timezone != tt.wantZone {
+				t.Errorf("timezone = %q, want %q", resp.Timezone, tt.wantZone)
+			}
+			ts, err := time.Parse(time.RFC3339, resp.Time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, offset := ts.Zone(); offset != tt.wantOffset {
+				t.Errorf("offset = %d, want %d", offset, tt.wantOffset)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// BufferedResponse 是被缓冲的完整响应。Header 就是底层 ResponseWriter 的响应头，对它的修改会直接生效。
+type BufferedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// ResponseTransformer 在响应写给客户端之前读取或修改它，例如为 JSON 响应加上统一的字段或响应头。
+type ResponseTransformer func(r *http.Request, resp *BufferedResponse)
+
+// ResponseMiddleware 缓冲处理程序的响应，交给 transform 修改后再写给客户端，并重新计算 Content-Length。
+// 响应体超过 maxBytes 或者处理程序调用了 Flush 时，缓冲的内容原样写出，之后的内容直接透传，transform 不会被调用，
+// 这样流式响应和大文件不会被整个放进内存。
+func ResponseMiddleware(maxBytes int64, transform ResponseTransformer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bw := &bufferingWriter{ResponseWriter: w, max: maxBytes}
+			next.ServeHTTP(bw, r)
+			if bw.passthrough {
+				return
+			}
+			resp := &BufferedResponse{Status: bw.Status(), Header: w.Header(), Body: bw.buf.Bytes()}
+			transform(r, resp)
+			// HEAD 请求没有响应体，不能据此改写 Content-Length。
+			if r.Method != http.MethodHead {
+				resp.Header.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+			}
+			w.WriteHeader(resp.Status)
+			w.Write(resp.Body)
+		})
+	}
+}
+
+// NewResponseEnvelopeMiddleware 按 EnvelopeConfig 为 JSON 响应加上公共字段。它必须在压缩中间件的外层，
+// 这样看到的是未压缩的响应体。
+func NewResponseEnvelopeMiddleware(cfg *Config) Middleware {
+	if !cfg.Envelope.RequestID {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return ResponseMiddleware(cfg.Envelope.MaxBodyBytes, injectRequestID)
+}
+
+// injectRequestID 为 JSON 对象响应加上 request_id 字段，已有这个字段、不是 JSON 对象或者已经编码过的响应保持不变。
+func injectRequestID(r *http.Request, resp *BufferedResponse) {
+	id := RequestIDFromContext(r.Context())
+	if id == "" || resp.Header.Get("Content-Encoding") != "" {
+		return
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "application/json" {
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(resp.Body, &fields); err != nil || fields == nil {
+		return
+	}
+	if _, ok := fields["request_id"]; ok {
+		return
+	}
+	fields["request_id"], _ = json.Marshal(id)
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	resp.Body = append(body, '\n')
+}
+
+// bufferingWriter 缓冲状态码和响应体，直到超出上限后切换为透传。
+type bufferingWriter struct {
+	http.ResponseWriter
+	max         int64
+	status      int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (w *bufferingWriter) WriteHeader(status int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	// 1xx 是中间响应，直接写出。
+	if status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferingWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if int64(w.buf.Len()+len(b)) > w.max {
+		if err := w.startPassthrough(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// startPassthrough 写出已经缓冲的内容，之后的写入直接交给底层的 ResponseWriter。
+func (w *bufferingWriter) startPassthrough() error {
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.Status())
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf = bytes.Buffer{}
+	return err
+}
+
+func (w *bufferingWriter) Flush() {
+	if !w.passthrough {
+		if err := w.startPassthrough(); err != nil {
+			return
+		}
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *bufferingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *bufferingWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// jsonRoute 写出 body 作为 JSON 响应；flush 为 true 时在两半之间调用 Flush。
+func jsonRoute(body string, flush bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !flush {
+			w.Write([]byte(body))
+			return
+		}
+		half := len(body) / 2
+		w.Write([]byte(body[:half]))
+		http.NewResponseController(w).Flush()
+		w.Write([]byte(body[half:]))
+	})
+}
+
+func TestResponseMiddleware(t *testing.T) {
+	tagged := func(r *http.Request, resp *BufferedResponse) {
+		resp.Header.Set("X-Transformed", "1")
+		resp.Body = append(resp.Body, " tail"...)
+	}
+	tests := []struct {
+		name            string
+		handler         http.Handler
+		maxBytes        int64
+		wantBody        string
+		wantTransformed bool
+	}{
+		{name: "buffered", handler: jsonRoute("hello", false), maxBytes: 16, wantBody: "hello tail", wantTransformed: true},
+		{name: "flush", handler: jsonRoute("hello", true), maxBytes: 16, wantBody: "hello"},
+		{name: "too large", handler: jsonRoute("hello", false), maxBytes: 2, wantBody: "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := ResponseMiddleware(tt.maxBytes, tagged)(tt.handler)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if got := rec.Header().Get("X-Transformed") != ""; got != tt.wantTransformed {
+				t.Errorf("transformed = %v, want %v", got, tt.wantTransformed)
+			}
+			wantLength := ""
+			if tt.wantTransformed {
+				wantLength = strconv.Itoa(len(tt.wantBody))
+			}
+			if got := rec.Header().Get("Content-Length"); got != wantLength {
+				t.Errorf("Content-Length = %q, want %q", got, wantLength)
+			}
+		})
+	}
+}
+
+func TestResponseEnvelopeMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantBody    string
+	}{
+		{name: "object", contentType: "application/json", body: `{"a":1}` + "\n", wantBody: `{"a":1,"request_id":"req-1"}` + "\n"},
+		{name: "charset", contentType: "application/json; charset=utf-8", body: `{}`, wantBody: `{"request_id":"req-1"}` + "\n"},
+		{name: "existing field", contentType: "application/json", body: `{"request_id":"other"}`, wantBody: `{"request_id":"other"}`},
+		{name: "array", contentType: "application/json", body: `[1,2]`, wantBody: `[1,2]`},
+		{name: "plain text", contentType: "text/plain", body: `{"a":1}`, wantBody: `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Envelope.RequestID = true
+			h := NewResponseEnvelopeMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, "req-1"))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if got, want := rec.Header().Get("Content-Length"), strconv.Itoa(len(tt.wantBody)); got != want {
+				t.Errorf("Content-Length = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestResponseEnvelopeMiddlewareDisabled(t *testing.T) {
+	next := jsonRoute(`{"a":1}`, false)
+	h := NewResponseEnvelopeMiddleware(testConfig(t))(next)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Body.String(); strings.Contains(got, "request_id") {
+		t.Errorf("body = %q, want no request_id", got)
+	}
+}
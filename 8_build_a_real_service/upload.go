@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// UploadHandler 接受 multipart/form-data 上传，把每个文件逐块写入 UploadConfig.Dir 中的临时文件，
+// 不会把整个文件读进内存。它返回每个文件的元数据。无论成功还是失败，临时文件都在请求结束时删除，
+// 真实的服务应当在这之前把它们移到持久的存储中。
+type UploadHandler struct {
+	handler  http.Handler
+	dir      string
+	maxFile  int64
+	maxTotal int64
+}
+
+func NewUploadHandler(log *zap.Logger, cfg *Config, renderer *ErrorRenderer) *UploadHandler {
+	h := &UploadHandler{dir: cfg.Upload.Dir, maxFile: cfg.Upload.MaxFileBytes, maxTotal: cfg.Upload.MaxBytes}
+	h.handler = HandleErrors(log, renderer, h.serve)
+	return h
+}
+
+func (*UploadHandler) Pattern() string {
+	return "/upload"
+}
+
+// 和 /echo 一样，上传需要更长的超时时间。
+func (*UploadHandler) Timeout() time.Duration {
+	return 30 * time.Second
+}
+
+// 整个请求体的上限由 UploadConfig.MaxBytes 决定，单个文件的上限是 UploadConfig.MaxFileBytes。
+func (h *UploadHandler) MaxBodyBytes() int64 {
+	return h.maxTotal
+}
+
+// 上传占用磁盘带宽，同时最多处理 4 个；其余的最多 8 个排队等待 5 秒，而不是立即得到 503。
+// 排队的时间计入 Timeout。
+func (*UploadHandler) MaxConcurrency() int {
+	return 4
+}
+
+func (*UploadHandler) MaxQueue() int {
+	return 8
+}
+
+func (*UploadHandler) QueueTimeout() time.Duration {
+	return 5 * time.Second
+}
+
+func (*UploadHandler) Methods() []string {
+	return []string{http.MethodPost}
+}
+
+func (*UploadHandler) MethodNotAllowedMessage() string {
+	return "Upload files with POST multipart/form-data"
+}
+
+func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+// uploadedFile 是返回给客户端的文件元数据。
+type uploadedFile struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+func (h *UploadHandler) serve(w http.ResponseWriter, r *http.Request) *HTTPError {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return &HTTPError{
+			Status:  http.StatusBadRequest,
+			Code:    "not_multipart",
+			Message: "Request must be multipart/form-data",
+			Err:     err,
+		}
+	}
+
+	files := []uploadedFile{}
+	var paths []string
+	defer func() {
+		for _, p := range paths {
+			os.Remove(p)
+		}
+	}()
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return uploadError(err)
+		}
+		// 只保存文件，普通的表单字段被忽略。
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		f, path, herr := h.save(r.Context(), part)
+		part.Close()
+		if path != "" {
+			paths = append(paths, path)
+		}
+		if herr != nil {
+			return herr
+		}
+		files = append(files, f)
+	}
+
+	if err := WriteJSON(w, http.StatusOK, files); err != nil {
+		return &HTTPError{
+			Status:  http.StatusInternalServerError,
+			Code:    "write_failed",
+			Message: "Failed to write response",
+			Err:     err,
+		}
+	}
+	return nil
+}
+
+// save 把 part 写入一个新的临时文件。只要临时文件已经创建，就会返回它的路径，即使写入失败，调用方也要负责删除它。
+func (h *UploadHandler) save(ctx context.Context, part *multipart.Part) (uploadedFile, string, *HTTPError) {
+	tmp, err := os.CreateTemp(h.dir, "upload-*")
+	if err != nil {
+		return uploadedFile{}, "", &HTTPError{
+			Status:  http.StatusInternalServerError,
+			Code:    "storage_failed",
+			Message: "Failed to store upload",
+			Err:     err,
+		}
+	}
+	path := tmp.Name()
+
+	// 多读一个字节，用来判断文件是否超过上限。
+	n, err := io.Copy(tmp, io.LimitReader(ctxReader{ctx, part}, h.maxFile+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return uploadedFile{}, path, uploadError(err)
+	}
+	if n > h.maxFile {
+		return uploadedFile{}, path, &HTTPError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    "file_too_large",
+			Message: "Uploaded file too large",
+			Fields:  []zap.Field{zap.String("filename", part.FileName()), zap.Int64("limit", h.maxFile)},
+		}
+	}
+	return uploadedFile{
+		Field:       part.FormName(),
+		Filename:    part.FileName(),
+		ContentType: part.Header.Get("Content-Type"),
+		Size:        n,
+	}, path, nil
+}
+
+// uploadError 把读取上传内容时的错误转换成 HTTPError。
+func uploadError(err error) *HTTPError {
+	herr := &HTTPError{
+		Status:  http.StatusBadRequest,
+		Code:    "upload_failed",
+		Message: "Failed to read upload",
+		Err:     err,
+	}
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		herr.Status = http.StatusRequestEntityTooLarge
+		herr.Code = "body_too_large"
+		herr.Message = "Request body too large"
+	} else if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		herr.Status = http.StatusServiceUnavailable
+		herr.Code = "upload_cancelled"
+		herr.Message = "Upload cancelled"
+	}
+	return herr
+}
+
+// ctxReader 在 context 结束后不再读取，让大文件的上传在客户端断开或请求超时时尽快停止。
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// multipartBody 构建一个 multipart/form-data 请求体，files 的键是文件名，fields 是普通的表单字段。
+func multipartBody(t *testing.T, files map[string]string, fields map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, mw.FormDataContentType()
+}
+
+func TestUploadHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		fields      map[string]string
+		contentType string
+		maxFile     int64
+		wantStatus  int
+		wantFiles   []uploadedFile
+		wantCode    string
+	}{
+		{
+			name:       "single file",
+			files:      map[string]string{"a.txt": "hello"},
+			wantStatus: http.StatusOK,
+			wantFiles:  []uploadedFile{{Field: "file", Filename: "a.txt", ContentType: "application/octet-stream", Size: 5}},
+		},
+		{
+			name:       "form fields are ignored",
+			files:      map[string]string{"a.txt": "hi"},
+			fields:     map[string]string{"note": "x"},
+			wantStatus: http.StatusOK,
+			wantFiles:  []uploadedFile{{Field: "file", Filename: "a.txt", ContentType: "application/octet-stream", Size: 2}},
+		},
+		{
+			name:       "file too large",
+			files:      map[string]string{"big.txt": strings.Repeat("x", 10)},
+			maxFile:    4,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   "file_too_large",
+		},
+		{
+			name:        "not multipart",
+			contentType: "text/plain",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    "not_multipart",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := testConfig(t)
+			cfg.Upload.Dir = dir
+			if tt.maxFile > 0 {
+				cfg.Upload.MaxFileBytes = tt.maxFile
+			}
+			h := NewUploadHandler(zap.NewNop(), cfg, testRenderer(t))
+
+			body, ct := multipartBody(t, tt.files, tt.fields)
+			if tt.contentType != "" {
+				ct = tt.contentType
+			}
+			req := httptest.NewRequest(http.MethodPost, "/upload", body)
+			req.Header.Set("Content-Type", ct)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %q", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantCode != "" {
+				if got := decodeError(t, rec).Code; got != tt.wantCode {
+					t.Errorf("code = %q, want %q", got, tt.wantCode)
+				}
+			} else {
+				var files []uploadedFile
+				if err := json.Unmarshal(rec.Body.Bytes(), &files); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				if len(files) != len(tt.wantFiles) || (len(files) > 0 && files[0] != tt.wantFiles[0]) {
+					t.Errorf("files = %+v, want %+v", files, tt.wantFiles)
+				}
+			}
+
+			// 无论成功还是失败，临时文件都要被删除。
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("upload dir has %d leftover files", len(entries))
+			}
+		})
+	}
+}
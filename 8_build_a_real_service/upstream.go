@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// UpstreamHandler 在 /upstream 把 GET 请求转发给 ClientConfig.UpstreamURL，并原样返回上游的状态码、Content-Type 和响应体。
+// 出站请求由 OutboundClient 发出，不会比入站请求活得更久；失败时按 UpstreamStatus 返回 504 或 502。
+type UpstreamHandler struct {
+	handler http.Handler
+	log     *zap.Logger
+	client  *OutboundClient
+	url     string
+}
+
+func NewUpstreamHandler(log *zap.Logger, client *OutboundClient, cfg *Config, renderer *ErrorRenderer) *UpstreamHandler {
+	h := &UpstreamHandler{log: log, client: client, url: cfg.Client.UpstreamURL}
+	h.handler = HandleErrors(log, renderer, h.serve)
+	return h
+}
+
+func (*UpstreamHandler) Pattern() string {
+	return "/upstream"
+}
+
+func (*UpstreamHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+func (h *UpstreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *UpstreamHandler) serve(w http.ResponseWriter, r *http.Request) *HTTPError {
+	out, err := http.NewRequest(http.MethodGet, h.url, nil)
+	if err != nil {
+		return &HTTPError{
+			Status:  http.StatusInternalServerError,
+			Code:    "invalid_upstream",
+			Message: "Failed to build upstream request",
+			Err:     err,
+		}
+	}
+	resp, err := h.client.Do(r, out)
+	if err != nil {
+		status, code, message := UpstreamStatus(err), "upstream_unavailable", "Upstream request failed"
+		if status == http.StatusGatewayTimeout {
+			code, message = "upstream_timeout", "Upstream request timed out"
+		}
+		return &HTTPError{Status: status, Code: code, Message: message, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		loggerFrom(r.Context(), h.log).Warn("Failed to copy upstream response", zap.Error(err))
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// slowUpstream 在请求被取消或者过了 delay 之后才响应，cancelled 在上游看到请求被取消时关闭。
+func slowUpstream(t *testing.T, delay time.Duration) (srv *httptest.Server, cancelled <-chan struct{}) {
+	t.Helper()
+	done := make(chan struct{})
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(done)
+		case <-time.After(delay):
+			w.Write([]byte("late"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, done
+}
+
+func testUpstreamHandler(t *testing.T, url string) *UpstreamHandler {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.Client.UpstreamURL = url
+	client := NewOutboundClient(NewHTTPClient(cfg), cfg)
+	return NewUpstreamHandler(zap.NewNop(), client, cfg, testRenderer(t))
+}
+
+func TestUpstreamHandler(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	rec := httptest.NewRecorder()
+	testUpstreamHandler(t, upstream.URL).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upstream", nil))
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := rec.Body.String(); got != `{"ok":true}` {
+		t.Errorf("body = %q, want the upstream body", got)
+	}
+}
+
+// 入站请求快要到期时，出站请求在入站请求的截止时间之前被取消，而不是等到上游响应。
+func TestUpstreamHandlerInboundDeadline(t *testing.T) {
+	upstream, cancelled := slowUpstream(t, 5*time.Second)
+	h := testUpstreamHandler(t, upstream.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/upstream", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h.ServeHTTP(rec, req)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("handler took %v, want it cut off by the inbound deadline", elapsed)
+	}
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", rec.Code)
+	}
+	if got := decodeError(t, rec).Code; got != "upstream_timeout" {
+		t.Errorf("code = %q, want upstream_timeout", got)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("outbound request outlived the inbound deadline")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("upstream did not see the request cancelled")
+	}
+}
+
+func TestOutboundClientDeadline(t *testing.T) {
+	upstream, _ := slowUpstream(t, 5*time.Second)
+	cfg := testConfig(t)
+	client := NewOutboundClient(NewHTTPClient(cfg), cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	in := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	out, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+	_, err := client.Do(in, out)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// refusedURL 返回一个刚刚关闭的监听地址，连接它会被拒绝。
+func refusedURL(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return "http://" + addr
+}
+
+func TestClassifyClientError(t *testing.T) {
+	slow, _ := slowUpstream(t, 5*time.Second)
+	get := func(client *http.Client, url string) error {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	dnsErr := &url.Error{Op: "Get", URL: "http://missing.invalid", Err: &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: &net.DNSError{Err: "no such host", Name: "missing.invalid", IsNotFound: true},
+	}}
+
+	tests := []struct {
+		name       string
+		err        error
+		want       error
+		wantStatus int
+	}{
+		{name: "refused", err: get(http.DefaultClient, refusedURL(t)), want: ErrUpstreamRefused, wantStatus: http.StatusBadGateway},
+		{name: "dns", err: dnsErr, want: ErrUpstreamDNS, wantStatus: http.StatusBadGateway},
+		{name: "deadline", err: get(&http.Client{Timeout: 50 * time.Millisecond}, slow.URL), want: ErrUpstreamTimeout, wantStatus: http.StatusGatewayTimeout},
+		{name: "other", err: errors.New("boom"), want: ErrUpstreamUnavailable, wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ClassifyClientError(tt.err)
+			if !errors.Is(err, tt.want) || !errors.Is(err, tt.err) {
+				t.Errorf("ClassifyClientError(%v) = %v, want it to wrap %v and the original error", tt.err, err, tt.want)
+			}
+			if got := UpstreamStatus(err); got != tt.wantStatus {
+				t.Errorf("UpstreamStatus() = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+
+	for _, err := range []error{nil, context.Canceled} {
+		if got := ClassifyClientError(err); got != err {
+			t.Errorf("ClassifyClientError(%v) = %v, want it unchanged", err, got)
+		}
+	}
+}
+
+func TestUpstreamHandlerRefused(t *testing.T) {
+	rec := httptest.NewRecorder()
+	testUpstreamHandler(t, refusedURL(t)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upstream", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", rec.Code)
+	}
+	if got := decodeError(t, rec).Code; got != "upstream_unavailable" {
+		t.Errorf("code = %q, want upstream_unavailable", got)
+	}
+}
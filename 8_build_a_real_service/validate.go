@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"go.uber.org/dig"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// expectedProvider 描述一个应用程序必须提供的核心组件。
+type expectedProvider struct {
+	name string
+	typ  reflect.Type
+}
+
+var expectedProviders = []expectedProvider{
+	{name: "logger", typ: reflect.TypeFor[*zap.Logger]()},
+	{name: "router", typ: reflect.TypeFor[Router]()},
+	{name: "server", typ: reflect.TypeFor[*http.Server]()},
+}
+
+// CheckProviders 在构建应用程序之前校验 opts。如果忘记提供某个核心组件（logger、router、server），
+// Fx 报告的是一长串依赖解析错误；CheckProviders 则直接列出缺少的组件。
+// 它使用 fx.ValidateApp，不会调用任何构造函数。
+func CheckProviders(opts fx.Option) error {
+	if err := fx.ValidateApp(opts, fx.NopLogger); err == nil {
+		return nil
+	}
+
+	var absent []string
+	for _, p := range expectedProviders {
+		// 检查用的 Invoke 放在 opts 之前，这样 opts 自己的 Invoke 失败时不会掩盖它的结果。
+		err := fx.ValidateApp(fx.Invoke(requireType(p.typ)), opts, fx.NopLogger)
+		if err != nil && isMissingType(err, p.typ) {
+			absent = append(absent, fmt.Sprintf("%s (%v)", p.name, p.typ))
+		}
+	}
+	if len(absent) == 0 {
+		// 问题不在核心组件上，原样返回 Fx 的错误。
+		return fx.ValidateApp(opts, fx.NopLogger)
+	}
+	return fmt.Errorf("the application is missing providers for: %s; add their constructors to fx.Provide",
+		strings.Join(absent, ", "))
+}
+
+// isMissingType 报告 err 的根本原因是否是缺少 typ 的提供者。
+// dig 没有导出对应的错误类型，只能解析 "missing type: T" 或 "missing types: A; B" 形式的描述。
+func isMissingType(err error, typ reflect.Type) bool {
+	msg := dig.RootCause(err).Error()
+	var list string
+	if rest, ok := strings.CutPrefix(msg, "missing types: "); ok {
+		list = rest
+	} else if rest, ok := strings.CutPrefix(msg, "missing type: "); ok {
+		list = rest
+	} else {
+		return false
+	}
+	for _, name := range strings.Split(list, "; ") {
+		// 去掉 dig 附加的 "(did you mean ...?)" 提示。
+		name, _, _ = strings.Cut(name, " (")
+		if name == typ.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// requireType 返回一个只依赖 typ 的空函数，用作 fx.Invoke 的参数。
+func requireType(typ reflect.Type) any {
+	fnType := reflect.FuncOf([]reflect.Type{typ}, nil, false)
+	return reflect.MakeFunc(fnType, func([]reflect.Value) []reflect.Value { return nil }).Interface()
+}
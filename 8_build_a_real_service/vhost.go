@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.uber.org/fx"
+)
+
+// vhostRoute 是 "vhost_routes" 组中的元素：路由和它所属的路由组的名字。
+type vhostRoute struct {
+	group string
+	route Route
+}
+
+// AsVHostRoute 把 f 提供的路由放进名为 group 的路由组，而不是 "routes" 组。VHostConfig.Hosts 把主机名映射到路由组，
+// Host 头匹配的请求只会交给这个组里的路由。和 AsMiddleware 一样，f 在自己的 fx.Module 中以 fx.Private 提供。
+func AsVHostRoute(group string, f any) fx.Option {
+	return fx.Module("vhost",
+		fx.Provide(
+			fx.Annotate(f, fx.As(new(Route))),
+			fx.Private,
+		),
+		fx.Provide(
+			fx.Annotate(
+				func(r Route) vhostRoute {
+					return vhostRoute{group: group, route: r}
+				},
+				fx.ResultTags(`group:"vhost_routes"`),
+			),
+		),
+	)
+}
+
+// VHostMux 按 Host 头把请求分发给不同的路由器，Host 不在 VHostConfig.Hosts 中的请求交给 fallback，
+// 也就是 "routes" 组的路由器。它本身也是 Router，所以按 Router.Match 查找路由的中间件不需要知道虚拟主机的存在；
+// Handle 注册到 fallback 上。
+type VHostMux struct {
+	hosts    map[string]Router
+	groups   map[string]string
+	fallback Router
+}
+
+// newVHostMux 为 VHostConfig.Hosts 引用的每个路由组创建路由器。多个主机名可以共用一个路由组。
+// 配置引用了不存在的路由组时返回错误。
+func (p routerParams) newVHostMux(fallback Router) (*VHostMux, error) {
+	groups := make(map[string][]Route)
+	for _, vr := range p.VHostRoutes {
+		groups[vr.group] = append(groups[vr.group], vr.route)
+	}
+
+	// 按主机名排序，让错误信息是确定的。
+	hosts := make([]string, 0, len(p.Config.VHost.Hosts))
+	for host := range p.Config.VHost.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	m := &VHostMux{hosts: make(map[string]Router, len(hosts)), groups: make(map[string]string, len(hosts)), fallback: fallback}
+	routers := make(map[string]Router)
+	for _, host := range hosts {
+		group := p.Config.VHost.Hosts[host]
+		mux, ok := routers[group]
+		if !ok {
+			routes, found := groups[group]
+			if !found {
+				return nil, fmt.Errorf("vhost %q: no routes in group %q", host, group)
+			}
+			var err error
+			if mux, err = p.build("vhost:"+group, routes); err != nil {
+				return nil, fmt.Errorf("vhost group %q: %w", group, err)
+			}
+			routers[group] = mux
+		}
+		m.hosts[normalizeHost(host)] = mux
+		m.groups[normalizeHost(host)] = group
+	}
+	return m, nil
+}
+
+// normalizeHost 去掉端口和末尾的点并转换成小写，"API.example.com.:8080" 和 "api.example.com" 是同一个主机。
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func (m *VHostMux) router(r *http.Request) Router {
+	if mux, ok := m.hosts[normalizeHost(r.Host)]; ok {
+		return mux
+	}
+	return m.fallback
+}
+
+// group 返回处理 r 的路由组的名字，交给 fallback 的请求返回空字符串。
+func (m *VHostMux) group(r *http.Request) string {
+	return m.groups[normalizeHost(r.Host)]
+}
+
+func (m *VHostMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.router(r).ServeHTTP(w, r)
+}
+
+func (m *VHostMux) Handle(pattern string, h http.Handler) {
+	m.fallback.Handle(pattern, h)
+}
+
+func (m *VHostMux) Match(r *http.Request) string {
+	return m.router(r).Match(r)
+}
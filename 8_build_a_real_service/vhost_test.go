@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// 两个路由组有同一个模式时，路由器之外的中间件按 Host 头找到各自的路由。
+func TestVHostRoutesPerRouteMiddleware(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Server.RequestTimeout = 0
+	cfg.VHost.Hosts = map[string]string{"api.example.com": "api"}
+	p := testRouterParams(t, cfg,
+		limitedRoute{pattern: "POST /upload", limit: 4},
+		limitedRoute{pattern: "GET /readyz"},
+	)
+	p.VHostRoutes = []vhostRoute{
+		{group: "api", route: limitedRoute{pattern: "POST /upload", limit: 64}},
+		{group: "api", route: probeRoute{pattern: "GET /readyz"}},
+	}
+	mux, err := NewRouter(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 预热一直没有完成，只有探针可以访问。
+	warmup := NewCacheWarmup(cacheWarmupParams{
+		Log:     zap.NewNop(),
+		Config:  &Config{},
+		Warmers: []CacheWarmer{func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- warmup.Run(ctx) }()
+	defer func() { cancel(); <-done }()
+
+	h := NewWarmupGateMiddleware(warmupGateParams{
+		Warmup:      warmup,
+		Renderer:    p.Renderer,
+		Router:      mux,
+		Routes:      p.Routes,
+		VHostRoutes: p.VHostRoutes,
+	})(mux)
+	for host, want := range map[string]int{
+		"www.example.com":      http.StatusServiceUnavailable,
+		"api.example.com":      http.StatusOK,
+		"API.example.com:8080": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("GET /readyz on %s = %d, want %d", host, rec.Code, want)
+		}
+	}
+
+	limited := NewBodyLimitMiddleware(bodyLimitParams{
+		Config:      cfg,
+		Renderer:    p.Renderer,
+		Router:      mux,
+		Routes:      p.Routes,
+		VHostRoutes: p.VHostRoutes,
+	})(mux)
+	for host, want := range map[string]int{"www.example.com": http.StatusRequestEntityTooLarge, "api.example.com": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("0123456789"))
+		req.Host = host
+		rec := httptest.NewRecorder()
+		limited.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("POST /upload on %s = %d, want %d", host, rec.Code, want)
+		}
+	}
+}
+
+// appOptions 注册的 "status" 路由组只提供探针，映射到它的主机名上没有业务路由。
+func TestVHostStatusGroup(t *testing.T) {
+	var h http.Handler
+	app := fxtest.New(t,
+		appOptions(),
+		fx.NopLogger,
+		fx.Decorate(func(cfg *Config) *Config {
+			cfg.Server.Addr = "127.0.0.1:0"
+			cfg.Log.Level = "error"
+			cfg.VHost.Hosts = map[string]string{"status.example.com": "status"}
+			return cfg
+		}),
+		fx.Populate(&h),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	tests := []struct {
+		host, target string
+		wantStatus   int
+	}{
+		{host: "status.example.com", target: "/readyz", wantStatus: http.StatusOK},
+		{host: "status.example.com", target: "/health", wantStatus: http.StatusOK},
+		{host: "status.example.com", target: "/time", wantStatus: http.StatusNotFound},
+		{host: "www.example.com", target: "/time", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("GET %s on %s = %d, want %d", tt.target, tt.host, rec.Code, tt.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// CacheWarmer 在启动时预热一个缓存，使第一批请求不必承担冷缓存的延迟。实现放入 "cache_warmers" 组，见 AsCacheWarmer。
+type CacheWarmer func(ctx context.Context) error
+
+// AsCacheWarmer 和 AsRoute 类似：它把构造函数返回的 CacheWarmer 放入 "cache_warmers" 组。
+func AsCacheWarmer(f any) any {
+	return fx.Annotate(
+		f,
+		fx.ResultTags(`group:"cache_warmers"`),
+	)
+}
+
+type cacheWarmupParams struct {
+	fx.In
+
+	Log     *zap.Logger
+	Config  *Config
+	Warmers []CacheWarmer `group:"cache_warmers"`
+}
+
+// CacheWarmup 并发执行 "cache_warmers" 组里的全部 CacheWarmer。NewHTTPServer 在服务器开始处理请求之后、
+// ReadinessProbe 变为就绪之前调用 Run，所以负载均衡器只会把流量发给已经预热的实例。
+type CacheWarmup struct {
+	log     *zap.Logger
+	fatal   bool
+	warmers []CacheWarmer
+	done    atomic.Bool
+}
+
+func NewCacheWarmup(p cacheWarmupParams) *CacheWarmup {
+	return &CacheWarmup{log: p.Log, fatal: p.Config.Warmup.Fatal, warmers: p.Warmers}
+}
+
+// Run 执行全部 CacheWarmer 并记录每一个的结果。WarmupConfig.Fatal 为 true 时，任何一个失败都会作为错误返回，
+// 否则失败只记录日志，应用程序照常就绪，缓存在之后的请求中逐渐填满。
+func (cw *CacheWarmup) Run(ctx context.Context) error {
+	defer cw.done.Store(true)
+	if len(cw.warmers) == 0 {
+		return nil
+	}
+	start := time.Now()
+	errs := make([]error, len(cw.warmers))
+	var wg sync.WaitGroup
+	for i, warm := range cw.warmers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := runtime.FuncForPC(reflect.ValueOf(warm).Pointer()).Name()
+			begin := time.Now()
+			if err := warm(ctx); err != nil {
+				cw.log.Warn("Cache warmer failed", zap.String("warmer", name), zap.Duration("duration", time.Since(begin)), zap.Error(err))
+				errs[i] = fmt.Errorf("%s: %w", name, err)
+				return
+			}
+			cw.log.Debug("Cache warmed", zap.String("warmer", name), zap.Duration("duration", time.Since(begin)))
+		}()
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	cw.log.Info("Cache warmup finished", zap.Int("warmers", len(cw.warmers)), zap.Duration("duration", time.Since(start)), zap.Error(err))
+	if err != nil && cw.fatal {
+		return fmt.Errorf("cache warmup: %w", err)
+	}
+	return nil
+}
+
+// Done 报告 Run 是否已经返回，无论预热是否成功。
+func (cw *CacheWarmup) Done() bool {
+	return cw.done.Load()
+}
+
+type warmupGateParams struct {
+	fx.In
+
+	Warmup      *CacheWarmup
+	Renderer    *ErrorRenderer
+	Router      Router
+	Routes      []Route      `group:"routes"`
+	VHostRoutes []vhostRoute `group:"vhost_routes"`
+}
+
+// NewWarmupGateMiddleware 在缓存预热完成之前对业务路由返回 503。服务器在预热之前就开始处理请求，
+// 探针（ProbeRoute，例如 /readyz 和 /health）照常响应，/readyz 报告尚未就绪，编排系统能区分"正在预热"和"没有响应"；
+// 其他请求，包括没有匹配路由的请求，都得到 503，而不是落到冷缓存上。预热结束后它只多一次原子读取。
+func NewWarmupGateMiddleware(p warmupGateParams) Middleware {
+	probes := newRouteLookup(p.Router, p.Routes, p.VHostRoutes, routeIs(isProbeRoute))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p.Warmup.Done() || probes.has(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			p.Renderer.Render(w, r, http.StatusServiceUnavailable, "warming up")
+		})
+	}
+}
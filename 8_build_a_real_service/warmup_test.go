@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// probeRoute 是一个总是返回 200 的探针。
+type probeRoute struct{ pattern string }
+
+func (r probeRoute) Pattern() string                            { return r.pattern }
+func (probeRoute) Probe() bool                                  { return true }
+func (probeRoute) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+func TestWarmupGateMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	warmup := NewCacheWarmup(cacheWarmupParams{
+		Log:    zap.NewNop(),
+		Config: &Config{},
+		Warmers: []CacheWarmer{func(ctx context.Context) error {
+			<-release
+			return nil
+		}},
+	})
+	routes := []Route{probeRoute{pattern: "/health"}, limitedRoute{pattern: "/echo"}}
+	mux := NewRouterProvider().NewRouter()
+	for _, route := range routes {
+		mux.Handle(route.Pattern(), route)
+	}
+	h := NewWarmupGateMiddleware(warmupGateParams{
+		Warmup:   warmup,
+		Renderer: testRenderer(t),
+		Router:   mux,
+		Routes:   routes,
+	})(mux)
+	status := func(target string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+
+	done := make(chan error)
+	go func() { done <- warmup.Run(context.Background()) }()
+
+	// 预热期间探针照常响应，业务路由和没有匹配的请求都得到 503。
+	for target, want := range map[string]int{"/health": http.StatusOK, "/echo": http.StatusServiceUnavailable, "/missing": http.StatusServiceUnavailable} {
+		if got := status(target); got != want {
+			t.Errorf("during warmup: GET %s = %d, want %d", target, got, want)
+		}
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := status("/echo"); got != http.StatusOK {
+		t.Errorf("after warmup: GET /echo = %d, want %d", got, http.StatusOK)
+	}
+}
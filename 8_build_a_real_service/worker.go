@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// WorkerTask 是 Worker 每个周期执行的任务。它必须在 ctx 被取消后尽快返回，见 WorkerConfig.TaskTimeout。
+type WorkerTask func(ctx context.Context) error
+
+// WorkerDependency 报告 Worker 依赖的外部资源（例如队列连接）是否可用，返回 nil 表示可用。
+type WorkerDependency func(ctx context.Context) error
+
+type workerParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Log       *zap.Logger
+	Config    *Config
+	Task      WorkerTask
+	Ready     WorkerDependency `optional:"true"`
+	Group     *errgroup.Group
+	GroupCtx  GroupContext
+	Startup   *StartupSignal
+	Rand      *rand.Rand
+}
+
+// Worker 在后台按 WorkerConfig.Interval 周期性地执行 WorkerTask。
+type Worker struct {
+	log   *zap.Logger
+	cfg   WorkerConfig
+	task  WorkerTask
+	ready WorkerDependency
+	rand  *rand.Rand
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWorker 在 OnStart 时启动 Worker。提供了 WorkerDependency 时，OnStart 先等待它返回 nil 再开始循环，
+// 等待超过 WorkerConfig.ReadyTimeout 时应用程序启动失败。循环运行在应用程序范围的 *errgroup.Group 中，
+// 组里其他 goroutine 失败时它也会停止。
+func NewWorker(p workerParams) *Worker {
+	w := &Worker{log: p.Log, cfg: p.Config.Worker, task: p.Task, ready: p.Ready, rand: p.Rand}
+	p.Lifecycle.Append(Interruptible(p.Startup, WithHookTimeout(p.Log, p.Config, "worker", fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if err := w.waitReady(ctx); err != nil {
+				return err
+			}
+			loopCtx, cancel := context.WithCancel(p.GroupCtx)
+			w.cancel = cancel
+			w.done = make(chan struct{})
+			p.Group.Go(func() error {
+				w.run(loopCtx)
+				return nil
+			})
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			w.cancel()
+			select {
+			case <-w.done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})))
+	return w
+}
+
+// waitReady 以指数退避轮询 WorkerDependency，每次失败都记录日志。每次等待的时间带有随机抖动，见 jitter。
+func (w *Worker) waitReady(ctx context.Context) error {
+	if w.ready == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.ReadyTimeout)
+	defer cancel()
+
+	backoff := w.cfg.ReadyBackoff
+	for attempt := 1; ; attempt++ {
+		err := w.ready(ctx)
+		if err == nil {
+			if attempt > 1 {
+				w.log.Info("Worker dependency ready", zap.Int("attempts", attempt))
+			}
+			return nil
+		}
+		wait := jitter(w.rand, backoff)
+		w.log.Info("Waiting for worker dependency", zap.Int("attempt", attempt), zap.Duration("backoff", wait), zap.Error(err))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("worker dependency not ready: %w", err)
+		}
+		backoff = min(backoff*2, maxWorkerBackoff)
+	}
+}
+
+// maxWorkerBackoff 是等待依赖时两次检查之间的最长间隔。
+const maxWorkerBackoff = 5 * time.Second
+
+func (w *Worker) run(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.tick(ctx)
+		}
+	}
+}
+
+// errTaskTimeout 是超过 WorkerConfig.TaskTimeout 时任务的 context 被取消的原因。
+var errTaskTimeout = errors.New("worker task timed out")
+
+// tick 执行一次任务。任务超过 WorkerConfig.TaskTimeout 时它的 context 被取消，这样卡住的任务不会无限期地推迟下一次执行。
+func (w *Worker) tick(ctx context.Context) {
+	if d := w.cfg.TaskTimeout; d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, d, errTaskTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := w.task(ctx)
+	if errors.Is(context.Cause(ctx), errTaskTimeout) {
+		w.log.Warn("Worker task overran its deadline", zap.Duration("timeout", w.cfg.TaskTimeout), zap.Duration("duration", time.Since(start)), zap.Error(err))
+		return
+	}
+	if err != nil {
+		w.log.Warn("Worker task failed", zap.Error(err))
+	}
+}
+
+// NewMetricsReportTask 是默认的 WorkerTask：定期把路由统计写入日志。
+func NewMetricsReportTask(log *zap.Logger, metrics *RouteMetrics) WorkerTask {
+	return func(ctx context.Context) error {
+		var requests, serverErrors uint64
+		for _, s := range metrics.Snapshot() {
+			requests += s.Requests
+			serverErrors += s.ServerErrors
+		}
+		log.Info("Route metrics", zap.Uint64("requests", requests), zap.Uint64("server_errors", serverErrors))
+		return nil
+	}
+}